@@ -0,0 +1,156 @@
+package easyhttp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	server, tearDown := setupScriptedServer(t, unavailableResponse, unavailableResponse, okResponse)
+	defer tearDown(t)
+	client := NewHTTPClient()
+	client.CircuitBreaker = NewCircuitBreakerSettings()
+	client.CircuitBreaker.ConsecutiveFailures = 2
+	client.CircuitBreaker.CoolDown = 100 * time.Millisecond
+
+	for range 2 {
+		request, err := NewRequest("http://localhost:1234/path")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if _, err := client.GET(request); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = client.GET(request)
+	var openErr *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) || openErr.Host != "http://localhost:1234" {
+		t.Fatalf("Expected circuit open error, got %v\n", err)
+	}
+	if len(server.requests()) != 2 {
+		t.Fatalf("Request was sent while the circuit was open")
+	}
+	if state := client.CircuitStates()["http://localhost:1234"]; state != CIRCUIT_OPEN {
+		t.Fatalf("Got circuit state %s\n", state)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if state := client.CircuitStates()["http://localhost:1234"]; state != CIRCUIT_HALF_OPEN {
+		t.Fatalf("Got circuit state %s after cool-down\n", state)
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_OK {
+		t.Fatalf("Got status %d from probe\n", response.StatusCode)
+	}
+	if state := client.CircuitStates()["http://localhost:1234"]; state != CIRCUIT_CLOSED {
+		t.Fatalf("Got circuit state %s after probe\n", state)
+	}
+}
+
+func TestCircuitBreakerConnectionFailures(t *testing.T) {
+	client := NewHTTPClient()
+	client.CircuitBreaker = NewCircuitBreakerSettings()
+	client.CircuitBreaker.ConsecutiveFailures = 1
+
+	request, err := NewRequest("http://localhost:1235/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := client.GET(request); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected dial error, got %v\n", err)
+	}
+	if _, err := client.GET(request); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected circuit open error, got %v\n", err)
+	}
+}
+
+type CircuitTest struct {
+	name     string
+	settings CircuitBreakerSettings
+	outcomes []bool
+	expected CircuitState
+}
+
+var circuitTests = []CircuitTest{
+	{"Consecutive failures", CircuitBreakerSettings{ConsecutiveFailures: 3, CoolDown: time.Minute}, []bool{true, true, true}, CIRCUIT_OPEN},
+	{"Success resets failures", CircuitBreakerSettings{ConsecutiveFailures: 3, CoolDown: time.Minute}, []bool{true, true, false, true, true}, CIRCUIT_CLOSED},
+	{"Failure rate", CircuitBreakerSettings{FailureRate: 0.5, MinimumRequests: 4, Window: time.Minute, CoolDown: time.Minute}, []bool{true, false, true, false}, CIRCUIT_OPEN},
+	{"Below failure rate", CircuitBreakerSettings{FailureRate: 0.5, MinimumRequests: 4, Window: time.Minute, CoolDown: time.Minute}, []bool{true, false, false, false, true}, CIRCUIT_CLOSED},
+	{"Below minimum requests", CircuitBreakerSettings{FailureRate: 0.5, MinimumRequests: 4, Window: time.Minute, CoolDown: time.Minute}, []bool{true, true, true}, CIRCUIT_CLOSED},
+	{"Half open probe failure", CircuitBreakerSettings{ConsecutiveFailures: 1, HalfOpenProbes: 2}, []bool{true, false, true}, CIRCUIT_OPEN},
+	{"Half open probes succeed", CircuitBreakerSettings{ConsecutiveFailures: 1, HalfOpenProbes: 2}, []bool{true, false, false}, CIRCUIT_CLOSED},
+	{"Half open waits for probes", CircuitBreakerSettings{ConsecutiveFailures: 1, HalfOpenProbes: 2}, []bool{true, false}, CIRCUIT_HALF_OPEN},
+}
+
+func TestCircuitStates(t *testing.T) {
+	for _, test := range circuitTests {
+		breakers := newCircuitBreakers()
+		for _, failed := range test.outcomes {
+			attempt, err := breakers.allow("http://example.com:80", &test.settings)
+			if err != nil {
+				break
+			}
+			var outcome error
+			if failed {
+				outcome = errors.New("failed")
+			}
+			attempt.record(&ClientHTTPResponse{StatusCode: STATUS_OK}, outcome)
+		}
+		if state := breakers.breakers["http://example.com:80"].state; state != test.expected {
+			t.Errorf("Test failed. %s: expected %s, got %s\n", test.name, test.expected, state)
+		}
+	}
+}
+
+func TestCircuitHalfOpenLimitsProbes(t *testing.T) {
+	settings := CircuitBreakerSettings{ConsecutiveFailures: 1, HalfOpenProbes: 1}
+	breakers := newCircuitBreakers()
+	attempt, _ := breakers.allow("http://example.com:80", &settings)
+	attempt.record(nil, errors.New("failed"))
+
+	probe, err := breakers.allow("http://example.com:80", &settings)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := breakers.allow("http://example.com:80", &settings); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Second probe was allowed")
+	}
+	probe.record(&ClientHTTPResponse{StatusCode: STATUS_OK}, nil)
+	if _, err := breakers.allow("http://example.com:80", &settings); err != nil {
+		t.Fatalf("Request rejected after circuit closed: %v\n", err)
+	}
+}
+
+func TestCircuitSkippedProbe(t *testing.T) {
+	settings := CircuitBreakerSettings{ConsecutiveFailures: 1, HalfOpenProbes: 1}
+	breakers := newCircuitBreakers()
+	attempt, _ := breakers.allow("http://example.com:80", &settings)
+	attempt.record(nil, errors.New("failed"))
+
+	probe, err := breakers.allow("http://example.com:80", &settings)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	probe.skip()
+	probe.record(nil, errors.New("failed"))
+	if state := breakers.breakers["http://example.com:80"].state; state != CIRCUIT_HALF_OPEN {
+		t.Fatalf("Skipped probe changed the circuit to %s\n", state)
+	}
+	probe, err = breakers.allow("http://example.com:80", &settings)
+	if err != nil {
+		t.Fatalf("Probe slot was not released: %v\n", err)
+	}
+	probe.record(&ClientHTTPResponse{StatusCode: STATUS_OK}, nil)
+	if state := breakers.breakers["http://example.com:80"].state; state != CIRCUIT_CLOSED {
+		t.Fatalf("Circuit did not close after the probe. Got %s\n", state)
+	}
+}
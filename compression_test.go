@@ -0,0 +1,237 @@
+package easyhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var compressibleText = strings.Repeat("As armas e os baroes assinalados\n", 200)
+
+func handleCompressible(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	response.SetStatus(STATUS_OK)
+	response.SetHeader("Content-Type", "text/plain; charset=utf-8")
+	response.SetHeader("Content-Length", "1")
+	response.Write([]byte(compressibleText))
+}
+
+func handleImage(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	response.SetStatus(STATUS_OK)
+	response.SetHeader("Content-Type", "image/png")
+	response.Write([]byte(compressibleText))
+}
+
+func handleCompressibleChunks(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	response.SetStatus(STATUS_OK)
+	response.SetHeader("Content-Type", "text/plain")
+	for _, line := range strings.SplitAfter(compressibleText, "\n")[:50] {
+		response.Write([]byte(line))
+		response.SendChunk()
+	}
+}
+
+func setupCompressionServer(tb testing.TB) func(tb testing.TB) {
+	server, err := NewHTTPServer(":1234")
+	if err != nil {
+		tb.Fatalf("Error creating HTTP Server")
+	}
+	server.SetTimeout(time.Duration(5) * time.Second)
+	server.Use(Compression(DefaultCompressionOptions()))
+	server.HandleGET("/text", handleCompressible)
+	server.HandleGET("/small", handleRequest)
+	server.HandleGET("/image", handleImage)
+	server.HandleGET("/chunked", handleCompressibleChunks)
+	go func() {
+		server.Run()
+	}()
+
+	return func(tb testing.TB) {
+		server.Close()
+	}
+}
+
+type EncodingNegotiationTest struct {
+	acceptEncoding   []string
+	expectedEncoding string
+}
+
+var encodingNegotiationTests = []EncodingNegotiationTest{
+	{acceptEncoding: nil, expectedEncoding: ""},
+	{acceptEncoding: []string{"gzip", "deflate"}, expectedEncoding: "gzip"},
+	{acceptEncoding: []string{"gzip;q=0.5", "deflate"}, expectedEncoding: "deflate"},
+	{acceptEncoding: []string{"gzip;q=0", "deflate;q=0"}, expectedEncoding: ""},
+	{acceptEncoding: []string{"br", "*;q=0.1"}, expectedEncoding: "gzip"},
+	{acceptEncoding: []string{"*;q=0.3", "gzip;q=0"}, expectedEncoding: "deflate"},
+	{acceptEncoding: []string{"identity"}, expectedEncoding: ""},
+	{acceptEncoding: []string{"X-GZIP"}, expectedEncoding: "gzip"},
+}
+
+func TestEncodingNegotiation(t *testing.T) {
+	for _, test := range encodingNegotiationTests {
+		got := negotiateEncoding(test.acceptEncoding)
+		if got != test.expectedEncoding {
+			t.Errorf("Test failed. Accept-Encoding: %v; Expected: %s; Got: %s\n", test.acceptEncoding, test.expectedEncoding, got)
+		}
+	}
+}
+
+func TestGzipCompression(t *testing.T) {
+	tearDown := setupCompressionServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/text")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetHeader("Accept-Encoding", "gzip, deflate")
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !response.HasHeaderValue("Content-Encoding", "gzip") || !response.HasHeaderValue("Vary", "Accept-Encoding") {
+		t.Fatalf("Response was not compressed")
+	}
+	if response.HasHeaderValue("Content-Length", "1") {
+		t.Fatalf("Stale content length was kept")
+	}
+	reader, err := gzip.NewReader(response.GetBody())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil || string(body) != compressibleText {
+		t.Fatalf("Wrong decompressed body")
+	}
+
+	request, err = NewRequest("http://localhost:1234/text")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetHeader("Accept-Encoding", "gzip;q=0.2, deflate;q=0.8")
+	response, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !response.HasHeaderValue("Content-Encoding", "deflate") {
+		t.Fatalf("Response was not compressed with deflate")
+	}
+	deflateReader, err := zlib.NewReader(response.GetBody())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body, err = io.ReadAll(deflateReader)
+	if err != nil || string(body) != compressibleText {
+		t.Fatalf("Wrong decompressed body")
+	}
+
+	request, err = NewRequest("http://localhost:1234/text")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.CloseConnection()
+	response, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.ExistsHeader("Content-Encoding") || !response.HasHeaderValue("Vary", "Accept-Encoding") {
+		t.Fatalf("Response should not be compressed")
+	}
+}
+
+func TestHeadCompressionHeaders(t *testing.T) {
+	tearDown := setupCompressionServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/text")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetHeader("Accept-Encoding", "gzip, deflate")
+	response, err := client.HEAD(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !response.HasHeaderValue("Content-Encoding", "gzip") || !response.HasHeaderValue("Vary", "Accept-Encoding") {
+		t.Fatalf("HEAD response is missing the compression headers")
+	}
+	if response.ExistsHeader("Content-Length") || response.HasBody() {
+		t.Fatalf("HEAD response has a length or body")
+	}
+
+	request, err = NewRequest("http://localhost:1234/text")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.CloseConnection()
+	response, err = client.HEAD(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.ExistsHeader("Content-Encoding") || !response.HasHeaderValue("Vary", "Accept-Encoding") {
+		t.Fatalf("HEAD response should not be compressed")
+	}
+	if !response.HasHeaderValue("Content-Length", strconv.Itoa(len(compressibleText))) || response.HasBody() {
+		t.Fatalf("HEAD response has the wrong length or a body")
+	}
+}
+
+func TestCompressionSkipped(t *testing.T) {
+	tearDown := setupCompressionServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	for _, path := range []string{"/small", "/image"} {
+		request, err := NewRequest("http://localhost:1234" + path)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		request.CloseConnection()
+		request.SetHeader("Accept-Encoding", "gzip")
+		response, err := client.GET(request)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if response.ExistsHeader("Content-Encoding") {
+			t.Fatalf("Response for %s should not be compressed", path)
+		}
+	}
+}
+
+func TestChunkedCompression(t *testing.T) {
+	tearDown := setupCompressionServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/chunked")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.CloseConnection()
+	request.SetHeader("Accept-Encoding", "gzip")
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !response.HasHeaderValue("Content-Encoding", "gzip") || !response.HasHeaderValue("Transfer-Encoding", "chunked") {
+		t.Fatalf("Chunked response was not compressed")
+	}
+	compressedBody, _ := io.ReadAll(response.GetBody())
+	reader, err := gzip.NewReader(bytes.NewReader(compressedBody))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(body) != strings.Join(strings.SplitAfter(compressibleText, "\n")[:50], "") {
+		t.Fatalf("Wrong decompressed body")
+	}
+}
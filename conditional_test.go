@@ -0,0 +1,236 @@
+package easyhttp
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileValidators(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	response, err := http.Get("http://localhost:1234/file")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response.Body.Close()
+	if response.StatusCode != STATUS_OK {
+		t.Fatalf("Got wrong STATUS %d\n", response.StatusCode)
+	}
+	etag := response.Header.Get("ETag")
+	lastModified := response.Header.Get("Last-Modified")
+	if etag == "" || lastModified == "" || response.Header.Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("Missing validators")
+	}
+
+	request, err := http.NewRequest(MethodGet, "http://localhost:1234/file", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.Header.Set("If-None-Match", etag)
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response.Body.Close()
+	if response.StatusCode != STATUS_NOT_MODIFIED || response.ContentLength > 0 {
+		t.Fatalf("Got wrong STATUS %d\n", response.StatusCode)
+	}
+
+	request, err = http.NewRequest(MethodGet, "http://localhost:1234/file", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.Header.Set("If-Modified-Since", lastModified)
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response.Body.Close()
+	if response.StatusCode != STATUS_NOT_MODIFIED {
+		t.Fatalf("Got wrong STATUS %d\n", response.StatusCode)
+	}
+
+	request, err = http.NewRequest(MethodGet, "http://localhost:1234/file", nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.Header.Set("If-Match", "\"stale\"")
+	request.Header.Add("Connection", "close")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response.Body.Close()
+	if response.StatusCode != STATUS_PRECONDITION_FAILED {
+		t.Fatalf("Got wrong STATUS %d\n", response.StatusCode)
+	}
+}
+
+type PreconditionTest struct {
+	headers        map[string]string
+	expectedStatus int
+}
+
+var preconditionTests = []PreconditionTest{
+	{headers: map[string]string{}, expectedStatus: STATUS_OK},
+	{headers: map[string]string{"If-None-Match": "\"dashboard-42\""}, expectedStatus: STATUS_NOT_MODIFIED},
+	{headers: map[string]string{"If-None-Match": "\"other\", W/\"dashboard-42\""}, expectedStatus: STATUS_NOT_MODIFIED},
+	{headers: map[string]string{"If-None-Match": "*"}, expectedStatus: STATUS_NOT_MODIFIED},
+	{headers: map[string]string{"If-None-Match": "\"other\"", "If-Modified-Since": conditionalModified.Format(HTTP_TIME_FORMAT)}, expectedStatus: STATUS_OK},
+	{headers: map[string]string{"If-Modified-Since": conditionalModified.Format(HTTP_TIME_FORMAT)}, expectedStatus: STATUS_NOT_MODIFIED},
+	{headers: map[string]string{"If-Modified-Since": conditionalModified.Add(-time.Hour).Format(HTTP_TIME_FORMAT)}, expectedStatus: STATUS_OK},
+	{headers: map[string]string{"If-Match": "W/\"dashboard-42\""}, expectedStatus: STATUS_PRECONDITION_FAILED},
+	{headers: map[string]string{"If-Match": "*"}, expectedStatus: STATUS_OK},
+	{headers: map[string]string{"If-Unmodified-Since": conditionalModified.Add(-time.Hour).Format(HTTP_TIME_FORMAT)}, expectedStatus: STATUS_PRECONDITION_FAILED},
+	{headers: map[string]string{"If-Unmodified-Since": conditionalModified.Format(time.RFC850)}, expectedStatus: STATUS_OK},
+}
+
+func TestHandlerPreconditions(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	for _, test := range preconditionTests {
+		request, err := http.NewRequest(MethodGet, "http://localhost:1234/conditional", nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		for key, value := range test.headers {
+			request.Header.Set(key, value)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		response.Body.Close()
+		if response.StatusCode != test.expectedStatus {
+			t.Errorf("Test failed. Headers: %v; Expected: %d; Got: %d\n", test.headers, test.expectedStatus, response.StatusCode)
+		}
+		if test.expectedStatus == STATUS_NOT_MODIFIED && response.Header.Get("ETag") != "W/\"dashboard-42\"" {
+			t.Errorf("Test failed. Headers: %v; 304 response is missing ETag\n", test.headers)
+		}
+	}
+}
+
+var conditionalUpdates atomic.Int32
+
+func conditionalValidators(request ServerHTTPRequest) (string, time.Time) {
+	return "dashboard-42", conditionalModified
+}
+
+func handleConditionalUpdate(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	conditionalUpdates.Add(1)
+	response.SetStatus(STATUS_NO_CONTENT)
+	response.SetETag("dashboard-43", false)
+}
+
+type UnsafePreconditionTest struct {
+	method          string
+	headers         map[string]string
+	expectedStatus  int
+	expectedUpdates int32
+}
+
+var unsafePreconditionTests = []UnsafePreconditionTest{
+	{method: MethodPut, headers: map[string]string{}, expectedStatus: STATUS_NO_CONTENT, expectedUpdates: 1},
+	{method: MethodPut, headers: map[string]string{"If-Match": "\"dashboard-42\""}, expectedStatus: STATUS_NO_CONTENT, expectedUpdates: 1},
+	{method: MethodPut, headers: map[string]string{"If-Match": "\"stale\""}, expectedStatus: STATUS_PRECONDITION_FAILED, expectedUpdates: 0},
+	{method: MethodPut, headers: map[string]string{"If-Unmodified-Since": conditionalModified.Add(-time.Hour).Format(HTTP_TIME_FORMAT)}, expectedStatus: STATUS_PRECONDITION_FAILED, expectedUpdates: 0},
+	{method: MethodPut, headers: map[string]string{"If-None-Match": "*"}, expectedStatus: STATUS_PRECONDITION_FAILED, expectedUpdates: 0},
+	{method: MethodDelete, headers: map[string]string{"If-Match": "\"stale\""}, expectedStatus: STATUS_NO_CONTENT, expectedUpdates: 1},
+}
+
+func TestUnsafePreconditionsBeforeHandler(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	for _, test := range unsafePreconditionTests {
+		conditionalUpdates.Store(0)
+		request, err := http.NewRequest(test.method, "http://localhost:1234/conditional", nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		for key, value := range test.headers {
+			request.Header.Set(key, value)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		response.Body.Close()
+		if response.StatusCode != test.expectedStatus {
+			t.Errorf("Test failed. Method: %s; Headers: %v; Expected: %d; Got: %d\n", test.method, test.headers, test.expectedStatus, response.StatusCode)
+		}
+		if updates := conditionalUpdates.Load(); updates != test.expectedUpdates {
+			t.Errorf("Test failed. Method: %s; Headers: %v; Handler ran %d times, expected %d\n", test.method, test.headers, updates, test.expectedUpdates)
+		}
+	}
+}
+
+var subSecondModified = time.Date(2024, time.March, 10, 12, 0, 0, 987654321, time.UTC)
+
+type SubSecondPreconditionTest struct {
+	method         string
+	header         string
+	expectedStatus int
+}
+
+var subSecondPreconditionTests = []SubSecondPreconditionTest{
+	{MethodGet, "If-Modified-Since", STATUS_NOT_MODIFIED},
+	{MethodPut, "If-Unmodified-Since", STATUS_NO_CONTENT},
+}
+
+func TestPreconditionsSubSecondValidator(t *testing.T) {
+	handler := Preconditions(func(request ServerHTTPRequest) (string, time.Time) {
+		return "", subSecondModified
+	})(handleConditionalUpdate)
+	uri := mustParseURL(t, "http://localhost:1234/conditional")
+
+	for _, test := range subSecondPreconditionTests {
+		var headers = Headers{strings.ToLower(test.header): {subSecondModified.Format(HTTP_TIME_FORMAT)}}
+		response := &ServerHTTPResponse{headers: make(Headers), body: new(bytes.Buffer)}
+		handler(ServerHTTPRequest{method: test.method, uri: uri, headers: headers}, response)
+		if response.statusCode != test.expectedStatus {
+			t.Errorf("Test failed. %s with %s: expected %d, got %d\n", test.method, test.header, test.expectedStatus, response.statusCode)
+		}
+	}
+}
+
+type ETagQuotingTest struct {
+	etag     string
+	weak     bool
+	expected string
+}
+
+var etagQuotingTests = []ETagQuotingTest{
+	{"abc", false, "\"abc\""},
+	{"\"abc\"", false, "\"abc\""},
+	{"abc", true, "W/\"abc\""},
+	{"W/\"abc\"", false, "W/\"abc\""},
+	{"W/\"abc\"", true, "W/\"abc\""},
+	{"abc\"", false, "\"abc\"\""},
+}
+
+func TestETagQuoting(t *testing.T) {
+	for _, test := range etagQuotingTests {
+		response := &ServerHTTPResponse{headers: make(Headers)}
+		response.SetETag(test.etag, test.weak)
+		if etag := joinHeaderValues(response.GetHeader("ETag")); etag != test.expected {
+			t.Errorf("Test failed. SetETag(%s, %t): expected %s, got %s\n", test.etag, test.weak, test.expected, etag)
+		}
+	}
+
+	handler := Preconditions(func(request ServerHTTPRequest) (string, time.Time) {
+		return "abc\"", time.Time{}
+	})(handleConditionalUpdate)
+	request := ServerHTTPRequest{method: MethodPut, uri: mustParseURL(t, "http://localhost:1234/conditional"), headers: Headers{"if-none-match": {"\"abc\"\""}}}
+	response := &ServerHTTPResponse{headers: make(Headers), body: new(bytes.Buffer)}
+	handler(request, response)
+	if response.statusCode != STATUS_PRECONDITION_FAILED || joinHeaderValues(response.GetHeader("ETag")) != "\"abc\"\"" {
+		t.Fatalf("Middleware quoted the tag differently from SetETag. Status %d, ETag %v\n", response.statusCode, response.GetHeader("ETag"))
+	}
+}
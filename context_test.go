@@ -0,0 +1,160 @@
+package easyhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDoWithContext(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.Do(context.Background(), request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_OK || !response.HasHeaderValue("TestHeader", "Hello") {
+		t.Fatalf("Wrong response %d\n", response.StatusCode)
+	}
+}
+
+func TestContextCancelledWhileReading(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/timeout")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = client.Do(ctx, request)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Got wrong error %v\n", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("Request was not aborted on cancellation")
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/timeout")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err = client.Do(ctx, request)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Got wrong error %v\n", err)
+	}
+	if errors.Is(err, ErrClientTimeout) {
+		t.Fatalf("Context deadline was reported as a client timeout")
+	}
+}
+
+func TestContextCancelledWhileStreamingChunks(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/runafter")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.Chunked()
+	request.SetMethod(MethodPost)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		request.SendChunk([]byte("first chunk"))
+		cancel()
+	}()
+
+	_, err = client.Do(ctx, request)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Got wrong error %v\n", err)
+	}
+}
+
+func TestContextCancelledWhileDialing(t *testing.T) {
+	client := NewHTTPClient()
+	client.MaxConnsPerHost = 1
+
+	listener, err := net.Listen("tcp", ":1234")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+	go func() {
+		connection, err := listener.Accept()
+		if err == nil {
+			defer connection.Close()
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	blockingRequest, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	go client.Do(context.Background(), blockingRequest)
+	time.Sleep(100 * time.Millisecond)
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = client.Do(ctx, request)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Request waiting for a connection was not aborted. Got %v\n", err)
+	}
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+	client.ResponseHeaderTimeout = 200 * time.Millisecond
+
+	request, err := NewRequest("http://localhost:1234/timeout")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.CloseConnection()
+	_, err = client.Do(context.Background(), request)
+	if !errors.Is(err, ErrClientTimeout) || err == ErrClientTimeout {
+		t.Fatalf("Got wrong error %v\n", err)
+	}
+}
+
+func TestPhaseDeadline(t *testing.T) {
+	now := time.Now()
+	requestDeadline := now.Add(time.Second)
+	if deadline := phaseDeadline(time.Time{}, 0); !deadline.IsZero() {
+		t.Errorf("Test failed. Expected no deadline; Got: %v\n", deadline)
+	}
+	if deadline := phaseDeadline(requestDeadline, time.Hour); !deadline.Equal(requestDeadline) {
+		t.Errorf("Test failed. Expected request deadline; Got: %v\n", deadline)
+	}
+	if deadline := phaseDeadline(requestDeadline, time.Millisecond); !deadline.Before(requestDeadline) {
+		t.Errorf("Test failed. Expected phase deadline; Got: %v\n", deadline)
+	}
+}
@@ -0,0 +1,194 @@
+package easyhttp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type CookieFileTest struct {
+	name   string
+	format CookieFileFormat
+}
+
+var cookieFileTests = []CookieFileTest{
+	{"cookies.json", COOKIE_FILE_JSON},
+	{"cookies.txt", COOKIE_FILE_NETSCAPE},
+}
+
+func TestPersistentCookieJar(t *testing.T) {
+	for _, test := range cookieFileTests {
+		path := filepath.Join(t.TempDir(), test.name)
+		jar, err := NewPersistentCookieJar(path, test.format)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		uri := mustParseURL(t, "https://api.example.test/app/login")
+		jar.SetCookies(uri, []*Cookie{
+			{Name: "session", Value: "abc", MaxAge: 3600, Domain: "example.test", Path: "/", Secure: true, HTTPOnly: true},
+			{Name: "host", Value: "xyz", Expires: time.Now().Add(time.Hour)},
+			{Name: "temporary", Value: "1"},
+		})
+		if err := jar.Save(); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		loaded, err := NewPersistentCookieJar(path, test.format)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if names := cookieNames(loaded.Cookies(uri)); names != "host,session" {
+			t.Errorf("Test failed. %s: got cookies %s after loading\n", test.name, names)
+		}
+		if names := cookieNames(loaded.Cookies(mustParseURL(t, "https://www.example.test/app/"))); names != "session" {
+			t.Errorf("Test failed. %s: host only cookie was not kept, got %s\n", test.name, names)
+		}
+		if names := cookieNames(loaded.Cookies(mustParseURL(t, "http://api.example.test/app/"))); names != "host" {
+			t.Errorf("Test failed. %s: secure cookie was not kept, got %s\n", test.name, names)
+		}
+
+		files, _ := os.ReadDir(filepath.Dir(path))
+		if len(files) != 1 {
+			t.Errorf("Test failed. %s: temporary files were left behind\n", test.name)
+		}
+	}
+}
+
+func TestPersistentCookieJarDropsExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	var expired = time.Now().Add(-time.Hour).Unix()
+	var valid = time.Now().Add(time.Hour).Unix()
+	content := "# Netscape HTTP Cookie File\n\n" +
+		".example.test\tTRUE\t/\tFALSE\t" + strconv.FormatInt(expired, 10) + "\told\t1\n" +
+		"#HttpOnly_example.test\tFALSE\t/\tFALSE\t" + strconv.FormatInt(valid, 10) + "\tfresh\t2\n" +
+		"example.test\tFALSE\t/\tFALSE\t0\tsession\t3\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	jar, err := NewPersistentCookieJar(path, COOKIE_FILE_NETSCAPE)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cookies := jar.Cookies(mustParseURL(t, "http://example.test/"))
+	if names := cookieNames(cookies); names != "fresh" {
+		t.Fatalf("Got cookies %s\n", names)
+	}
+	if !cookies[0].HTTPOnly {
+		t.Fatalf("HttpOnly prefix was not read")
+	}
+
+	if err := jar.Save(); err != nil {
+		t.Fatal(err.Error())
+	}
+	saved, _ := os.ReadFile(path)
+	if strings.Contains(string(saved), "old") || !strings.Contains(string(saved), "#HttpOnly_example.test\tFALSE") {
+		t.Fatalf("Saved file is wrong:\n%s", saved)
+	}
+}
+
+func TestPersistentCookieJarBadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	if err := os.WriteFile(path, []byte("example.test\tFALSE\t/\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := NewPersistentCookieJar(path, COOKIE_FILE_NETSCAPE); err == nil {
+		t.Fatalf("Malformed cookie file was accepted")
+	}
+}
+
+func TestPersistentCookieJarSavesRemovals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	jar, err := NewPersistentCookieJar(path, COOKIE_FILE_JSON)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	uri := mustParseURL(t, "http://example.test/")
+	jar.SetCookies(uri, []*Cookie{{Name: "replaced", Value: "1", MaxAge: 3600}, {Name: "removed", Value: "2", MaxAge: 3600}})
+	jar.SetCookies(uri, []*Cookie{{Name: "replaced", Value: "session"}})
+	loaded, err := NewPersistentCookieJar(path, COOKIE_FILE_JSON)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if names := cookieNames(loaded.Cookies(uri)); names != "removed" {
+		t.Fatalf("Persistent cookie replaced by a session cookie was kept in the file. Got %s\n", names)
+	}
+
+	jar.SetCookies(uri, []*Cookie{{Name: "removed", MaxAge: -1}})
+	loaded, err = NewPersistentCookieJar(path, COOKIE_FILE_JSON)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if names := cookieNames(loaded.Cookies(uri)); names != "" {
+		t.Fatalf("Removed cookie was kept in the file. Got %s\n", names)
+	}
+}
+
+func TestPersistentCookieJarSaveError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "cookies.json")
+	jar, err := NewPersistentCookieJar(path, COOKIE_FILE_JSON)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var saveErrors []error
+	jar.OnSaveError = func(err error) {
+		saveErrors = append(saveErrors, err)
+	}
+	jar.SetCookies(mustParseURL(t, "http://example.test/"), []*Cookie{{Name: "temporary", Value: "1"}})
+	if len(saveErrors) != 0 {
+		t.Fatalf("Session cookie caused a save")
+	}
+	jar.SetCookies(mustParseURL(t, "http://example.test/"), []*Cookie{{Name: "persistent", Value: "1", MaxAge: 3600}})
+	if len(saveErrors) != 1 || !errors.Is(saveErrors[0], os.ErrNotExist) {
+		t.Fatalf("Save error was not reported. Got %v\n", saveErrors)
+	}
+}
+
+func TestClientWithPersistentCookieJar(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	path := filepath.Join(t.TempDir(), "cookies.json")
+
+	jar, err := NewPersistentCookieJar(path, COOKIE_FILE_JSON)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	client := NewHTTPClient()
+	client.CookieJar = jar
+	request, err := NewRequest("http://localhost:1234/cookie")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := client.GET(request); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	jar, err = NewPersistentCookieJar(path, COOKIE_FILE_JSON)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	client = NewHTTPClient()
+	client.CookieJar = jar
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	bodyBuffer := make([]byte, 1024)
+	bodyLength, _ := response.Read(bodyBuffer)
+	if string(bodyBuffer[:bodyLength]) != "Cookie Received!\n" {
+		t.Fatalf("Cookie was not kept between clients")
+	}
+
+	client.CookieJar = nil
+	response, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(response.Cookies()) != 1 {
+		t.Fatalf("Cookie was sent without a jar")
+	}
+}
@@ -1,9 +1,28 @@
 package easyhttp
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+func handleCookieEcho(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	var names []string
+	for name := range request.Cookies() {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	response.SetStatus(STATUS_OK)
+	response.Write([]byte(strings.Join(names, ",")))
+}
+
 func TestCookies(t *testing.T) {
 	tearDown := setupServer(t)
 	defer tearDown(t)
@@ -94,3 +113,384 @@ func TestCookieServerResponse(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	uri, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return uri
+}
+
+func cookieNames(cookies []*Cookie) string {
+	var names []string
+	for _, cookie := range cookies {
+		names = append(names, cookie.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+type CookieMatchTest struct {
+	setURL   string
+	cookie   Cookie
+	getURL   string
+	expected bool
+}
+
+var cookieMatchTests = []CookieMatchTest{
+	{"http://example.test/", Cookie{Name: "a", Domain: "example.test"}, "http://api.example.test/", true},
+	{"http://example.test/", Cookie{Name: "a", Domain: ".example.test"}, "http://api.example.test/", true},
+	{"http://example.test/", Cookie{Name: "a"}, "http://api.example.test/", false},
+	{"http://example.test/", Cookie{Name: "a"}, "http://EXAMPLE.test/", true},
+	{"http://api.example.test/", Cookie{Name: "a", Domain: "example.test"}, "http://example.test/", true},
+	{"http://api.example.test/", Cookie{Name: "a", Domain: "other.test"}, "http://other.test/", false},
+	{"http://example.test/", Cookie{Name: "a", Domain: "test"}, "http://other.test/", false},
+	{"http://badexample.test/", Cookie{Name: "a", Domain: "example.test"}, "http://example.test/", false},
+	{"http://example.test/", Cookie{Name: "a", Path: "/app"}, "http://example.test/app", true},
+	{"http://example.test/", Cookie{Name: "a", Path: "/app"}, "http://example.test/app/users", true},
+	{"http://example.test/", Cookie{Name: "a", Path: "/app"}, "http://example.test/application", false},
+	{"http://example.test/", Cookie{Name: "a", Path: "/app/"}, "http://example.test/app/users", true},
+	{"http://example.test/app/users", Cookie{Name: "a"}, "http://example.test/app/settings", true},
+	{"http://example.test/app/users", Cookie{Name: "a"}, "http://example.test/", false},
+	{"http://example.test/", Cookie{Name: "a", Secure: true}, "http://example.test/", false},
+	{"http://example.test/", Cookie{Name: "a", Secure: true}, "https://example.test/", true},
+	{"http://example.test/", Cookie{Name: "a", MaxAge: 60}, "http://example.test/", true},
+	{"http://example.test/", Cookie{Name: "a", MaxAge: -1}, "http://example.test/", false},
+	{"http://example.test/", Cookie{Name: "a", Expires: time.Now().Add(-time.Hour)}, "http://example.test/", false},
+	{"http://example.test/", Cookie{Name: "a", SameSite: SAME_SITE_NONE}, "http://example.test/", false},
+	{"http://127.0.0.1/", Cookie{Name: "a", Domain: "0.0.1"}, "http://127.0.0.1/", false},
+}
+
+func TestCookieMatching(t *testing.T) {
+	for _, test := range cookieMatchTests {
+		storage := NewCookieStorage()
+		cookie := test.cookie
+		storage.SetCookies(mustParseURL(t, test.setURL), []*Cookie{&cookie})
+		cookies := storage.Cookies(mustParseURL(t, test.getURL))
+		if (len(cookies) == 1) != test.expected {
+			t.Errorf("Test failed. Cookie %+v set by %s and sent to %s: expected %t\n", test.cookie, test.setURL, test.getURL, test.expected)
+		}
+	}
+}
+
+func TestCookieDeletion(t *testing.T) {
+	storage := NewCookieStorage()
+	uri := mustParseURL(t, "http://example.test/")
+	storage.SetCookies(uri, []*Cookie{{Name: "session", Value: "1"}, {Name: "theme", Value: "dark"}})
+
+	deletion, err := parseSetCookieLine("session=; Max-Age=0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	storage.SetCookies(uri, []*Cookie{deletion, {Name: "theme", MaxAge: -1}})
+	if cookies := storage.Cookies(uri); len(cookies) != 0 {
+		t.Fatalf("Cookies were not deleted: %s\n", cookieNames(cookies))
+	}
+}
+
+func TestCookieOrdering(t *testing.T) {
+	storage := NewCookieStorage()
+	uri := mustParseURL(t, "http://example.test/app/users/list")
+	storage.SetCookies(uri, []*Cookie{{Name: "root", Path: "/"}})
+	storage.SetCookies(uri, []*Cookie{{Name: "users", Path: "/app/users"}})
+	storage.SetCookies(uri, []*Cookie{{Name: "app", Path: "/app"}})
+	time.Sleep(time.Millisecond)
+	storage.SetCookies(uri, []*Cookie{{Name: "other", Path: "/app"}})
+	// Replacing a cookie keeps its creation time
+	storage.SetCookies(uri, []*Cookie{{Name: "app", Value: "new", Path: "/app"}})
+
+	cookies := storage.Cookies(uri)
+	if names := cookieNames(cookies); names != "users,app,other,root" {
+		t.Fatalf("Got cookies in order %s\n", names)
+	}
+	if cookies[1].Value != "new" {
+		t.Fatalf("Cookie was not replaced")
+	}
+}
+
+func TestCookieLimits(t *testing.T) {
+	storage := NewCookieStorage()
+	storage.MaxCookiesPerDomain = 3
+	storage.MaxCookies = 4
+	first := mustParseURL(t, "http://first.test/")
+	second := mustParseURL(t, "http://second.test/")
+
+	for i := range 3 {
+		storage.SetCookies(first, []*Cookie{{Name: fmt.Sprintf("first%d", i)}})
+	}
+	// Using first0 makes first1 the least recently used
+	storage.SetCookies(first, []*Cookie{{Name: "first0", Path: "/"}})
+	storage.SetCookies(first, []*Cookie{{Name: "first3"}})
+	if names := cookieNames(storage.Cookies(first)); names != "first0,first2,first3" {
+		t.Fatalf("Got cookies %s after domain limit\n", names)
+	}
+
+	storage.SetCookies(second, []*Cookie{{Name: "second0"}, {Name: "second1"}})
+	if cookies := storage.Cookies(first); len(cookies) != 2 {
+		t.Fatalf("Got %d cookies after total limit\n", len(cookies))
+	}
+	if names := cookieNames(storage.Cookies(second)); names != "second0,second1" {
+		t.Fatalf("Got cookies %s for second domain\n", names)
+	}
+}
+
+const testSuffixList = `// Test list
+com
+uk
+co.uk
+*.ck
+!www.ck
+
+github.io
+`
+
+type PublicSuffixTest struct {
+	domain   string
+	expected string
+}
+
+var publicSuffixTests = []PublicSuffixTest{
+	{"example.com", "com"},
+	{"example.co.uk", "co.uk"},
+	{"co.uk", "co.uk"},
+	{"example.uk", "uk"},
+	{"a.b.ck", "b.ck"},
+	{"www.ck", "ck"},
+	{"user.github.io", "github.io"},
+	{"example.test", "test"},
+}
+
+func TestPublicSuffixList(t *testing.T) {
+	list, err := ParsePublicSuffixList(strings.NewReader(testSuffixList))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, test := range publicSuffixTests {
+		if suffix := list.PublicSuffix(test.domain); suffix != test.expected {
+			t.Errorf("Test failed. Public suffix of %s: expected %s, got %s\n", test.domain, test.expected, suffix)
+		}
+	}
+
+	storage := NewCookieStorage()
+	storage.PublicSuffixes = list
+	storage.SetCookies(mustParseURL(t, "http://example.co.uk/"), []*Cookie{{Name: "suffix", Domain: "co.uk"}, {Name: "site", Domain: "example.co.uk"}})
+	if names := cookieNames(storage.Cookies(mustParseURL(t, "http://other.co.uk/"))); names != "" {
+		t.Fatalf("Cookie for a public suffix was stored: %s\n", names)
+	}
+	if names := cookieNames(storage.Cookies(mustParseURL(t, "http://www.example.co.uk/"))); names != "site" {
+		t.Fatalf("Got cookies %s\n", names)
+	}
+
+	storage.SetCookies(mustParseURL(t, "http://user.github.io/"), []*Cookie{{Name: "pages", Domain: "user.github.io"}})
+	if cookies := storage.Cookies(mustParseURL(t, "http://other.github.io/")); len(cookies) != 0 {
+		t.Fatalf("Cookie was shared between sites")
+	}
+}
+
+func TestDefaultPublicSuffixList(t *testing.T) {
+	storage := NewCookieStorage()
+	storage.SetCookies(mustParseURL(t, "http://example.co.uk/"), []*Cookie{{Name: "suffix", Domain: "co.uk"}, {Name: "site", Domain: "example.co.uk"}})
+	if names := cookieNames(storage.Cookies(mustParseURL(t, "http://other.co.uk/"))); names != "" {
+		t.Fatalf("Cookie for a public suffix was stored: %s\n", names)
+	}
+	if names := cookieNames(storage.Cookies(mustParseURL(t, "http://www.example.co.uk/"))); names != "site" {
+		t.Fatalf("Got cookies %s\n", names)
+	}
+
+	client := NewHTTPClient()
+	client.SetCookies(mustParseURL(t, "http://example.co.uk/"), []*Cookie{{Name: "suffix", Domain: "co.uk"}})
+	if cookies := client.Cookies(mustParseURL(t, "http://other.co.uk/")); len(cookies) != 0 {
+		t.Fatalf("Default jar stored a cookie for a public suffix")
+	}
+	client.SetCookies(mustParseURL(t, "http://user.github.io/"), []*Cookie{{Name: "pages", Domain: "github.io"}})
+	if cookies := client.Cookies(mustParseURL(t, "http://other.github.io/")); len(cookies) != 0 {
+		t.Fatalf("Default jar stored a cookie for a public suffix")
+	}
+}
+
+func TestCookieSameSiteOnRedirect(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+	target := mustParseURL(t, "http://127.0.0.1:1234/cookie/echo")
+	client.SetCookies(target, []*Cookie{
+		{Name: "strict", SameSite: SAME_SITE_STRICT},
+		{Name: "lax", SameSite: SAME_SITE_LAX},
+		{Name: "default"},
+	})
+
+	request, err := NewRequest("http://127.0.0.1:1234/cookie/echo")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if body, _ := io.ReadAll(response.Body()); string(body) != "default,lax,strict" {
+		t.Fatalf("Got cookies %s on a same site request\n", body)
+	}
+
+	request, err = NewRequest("http://localhost:1234/cookie/cross-site")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if body, _ := io.ReadAll(response.Body()); string(body) != "default,lax" {
+		t.Fatalf("Got cookies %s after a cross site redirect\n", body)
+	}
+}
+
+func TestCookieStorageConcurrency(t *testing.T) {
+	storage := NewCookieStorage()
+	uri := mustParseURL(t, "http://example.test/")
+	var group sync.WaitGroup
+	for i := range 8 {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for j := range 100 {
+				storage.SetCookies(uri, []*Cookie{{Name: fmt.Sprintf("cookie%d", (i+j)%10)}})
+				storage.Cookies(uri)
+			}
+		}()
+	}
+	group.Wait()
+	if cookies := storage.Cookies(uri); len(cookies) != 10 {
+		t.Fatalf("Got %d cookies\n", len(cookies))
+	}
+}
+
+type SetCookieTest struct {
+	line     string
+	expected Cookie
+	valid    bool
+}
+
+var setCookieTests = []SetCookieTest{
+	{"id=a3fWa; Expires=Wed, 21 Oct 2015 07:28:00 GMT", Cookie{Name: "id", Value: "a3fWa", Expires: time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)}, true},
+	{"id=a3fWa; expires=Wednesday, 21-Oct-15 07:28:00 GMT", Cookie{Name: "id", Value: "a3fWa", Expires: time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)}, true},
+	{"id=a3fWa; Expires=Wed Oct 21 07:28:00 2015", Cookie{Name: "id", Value: "a3fWa", Expires: time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)}, true},
+	{"id=a3fWa; Expires=Wed, 21-Oct-2015 07:28:00 GMT", Cookie{Name: "id", Value: "a3fWa", Expires: time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)}, true},
+	{"id=a3fWa; Expires=not a date; Path=/docs", Cookie{Name: "id", Value: "a3fWa", Path: "/docs"}, true},
+	{"token=abc==; Path=docs", Cookie{Name: "token", Value: "abc=="}, true},
+	{" quoted = \"hello\" ; Domain=.Example.test", Cookie{Name: "quoted", Value: "hello", Domain: "example.test"}, true},
+	{"empty=; Secure; HttpOnly", Cookie{Name: "empty", Secure: true, HTTPOnly: true}, true},
+	{"id=1; Partitioned; Priority=High; Secure", Cookie{Name: "id", Value: "1", Secure: true, Unparsed: []string{"Partitioned", "Priority=High"}}, true},
+	{"id=1; SameSite=Unknown", Cookie{Name: "id", Value: "1"}, true},
+	{"id=1; SameSite=None", Cookie{Name: "id", Value: "1", SameSite: SAME_SITE_NONE}, true},
+	{"id=1; Max-Age=abc", Cookie{Name: "id", Value: "1"}, true},
+	{"bare", Cookie{}, false},
+	{"=value", Cookie{}, false},
+}
+
+func TestSetCookieParsing(t *testing.T) {
+	for _, test := range setCookieTests {
+		cookie, err := parseSetCookieLine(test.line)
+		if (err == nil) != test.valid {
+			t.Errorf("Test failed. %q: expected valid %t, got error %v\n", test.line, test.valid, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		cookie.creation = time.Time{}
+		if cookie.Name != test.expected.Name || cookie.Value != test.expected.Value || !cookie.Expires.Equal(test.expected.Expires) ||
+			cookie.Path != test.expected.Path || cookie.Domain != test.expected.Domain || cookie.Secure != test.expected.Secure ||
+			cookie.HTTPOnly != test.expected.HTTPOnly || cookie.SameSite != test.expected.SameSite ||
+			!slices.Equal(cookie.Unparsed, test.expected.Unparsed) {
+			t.Errorf("Test failed. %q: expected %+v, got %+v\n", test.line, test.expected, *cookie)
+		}
+	}
+}
+
+type CookieHeaderTest struct {
+	line     string
+	expected map[string]string
+}
+
+var cookieHeaderTests = []CookieHeaderTest{
+	{"a=1; b=2", map[string]string{"a": "1", "b": "2"}},
+	{"token=abc==;theme=dark", map[string]string{"token": "abc==", "theme": "dark"}},
+	{"bare; a=\"quoted\"", map[string]string{"bare": "", "a": "quoted"}},
+	{"=nameless; ; a=1,2", map[string]string{"a": "1,2"}},
+}
+
+func TestCookieHeaderParsing(t *testing.T) {
+	for _, test := range cookieHeaderTests {
+		if cookies := parseCookieHeader(test.line); !maps.Equal(cookies, test.expected) {
+			t.Errorf("Test failed. %q: expected %v, got %v\n", test.line, test.expected, cookies)
+		}
+	}
+}
+
+type CookieStringTest struct {
+	cookie   Cookie
+	expected string
+	valid    bool
+}
+
+var cookieStringTests = []CookieStringTest{
+	{Cookie{Name: "id", Value: "1", Path: "/", Expires: time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)}, "id=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT; Path=/", true},
+	{Cookie{Name: "id", Value: "a b"}, "id=\"a b\"", false},
+	{Cookie{Name: "id", Value: "a;b\"c\\d"}, "id=abcd", false},
+	{Cookie{Name: "id", Value: "\"quoted\""}, "id=quoted", true},
+	{Cookie{Name: "bad name", Value: "1"}, "", false},
+	{Cookie{Name: "id", Value: "1", Path: "/a;b"}, "id=1", false},
+	{Cookie{Name: "id", Value: "1", Domain: "bad domain"}, "id=1", false},
+	{Cookie{Name: "id", Value: "1", Domain: ".example.test"}, "id=1; Domain=example.test", true},
+	{Cookie{Name: "id", Value: "1", SameSite: SAME_SITE_NONE}, "id=1; SameSite=None", false},
+	{Cookie{Name: "id", Value: "1", Secure: true, Unparsed: []string{"Partitioned"}}, "id=1; Secure; Partitioned", true},
+}
+
+func TestCookieString(t *testing.T) {
+	for _, test := range cookieStringTests {
+		if cookieString := test.cookie.String(); cookieString != test.expected {
+			t.Errorf("Test failed. Expected %q, got %q\n", test.expected, cookieString)
+		}
+		if err := test.cookie.Valid(); (err == nil) != test.valid || err != nil && !errors.Is(err, ErrInvalidCookie) {
+			t.Errorf("Test failed. %+v: expected valid %t, got %v\n", test.cookie, test.valid, err)
+		}
+	}
+}
+
+func TestCookiesWithCommas(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/cookie/expires")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cookies := response.Cookies()
+	if len(cookies) != 2 || cookies[0].Expires.Year() != 2100 || cookies[1].Value != "abc==" {
+		t.Fatalf("Cookies with commas were not parsed: %v\n", response.GetHeader("Set-Cookie"))
+	}
+
+	request, err = NewRequest("http://localhost:1234/cookie/echo")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetHeader("Cookie", "bare; list=a,b; token=abc==")
+	response, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if body, _ := io.ReadAll(response.Body()); string(body) != "bare,expiring,list,token" {
+		t.Fatalf("Got cookies %s\n", body)
+	}
+}
+
+func handleExpiringCookies(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	response.SetStatus(STATUS_OK)
+	response.SetCookie(&Cookie{Name: "expiring", Value: "1", Expires: time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC)})
+	response.SetCookie(&Cookie{Name: "token", Value: "abc=="})
+}
@@ -0,0 +1,128 @@
+package easyhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"testing"
+	"time"
+)
+
+func setupDecompressionServer(tb testing.TB) func(tb testing.TB) {
+	server, err := NewHTTPServer(":1234")
+	if err != nil {
+		tb.Fatalf("Error creating HTTP Server")
+	}
+	server.SetTimeout(time.Duration(5) * time.Second)
+	server.EnableRequestDecompression(64 * 1024)
+	server.HandlePOST("/echo", handleEcho)
+	go func() {
+		server.Run()
+	}()
+
+	return func(tb testing.TB) {
+		server.Close()
+	}
+}
+
+func gzipBytes(data []byte) []byte {
+	buffer := new(bytes.Buffer)
+	writer := gzip.NewWriter(buffer)
+	writer.Write(data)
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func TestRequestDecompression(t *testing.T) {
+	tearDown := setupDecompressionServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequestWithBody("http://localhost:1234/echo", gzipBytes([]byte("telemetry payload")))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetHeader("Content-Encoding", "gzip")
+	response, err := client.POST(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body, _ := io.ReadAll(response.GetBody())
+	if response.StatusCode != STATUS_OK || string(body) != "telemetry payload" {
+		t.Fatalf("Wrong decompressed body %s", body)
+	}
+
+	deflateBuffer := new(bytes.Buffer)
+	deflateWriter := zlib.NewWriter(deflateBuffer)
+	deflateWriter.Write(gzipBytes([]byte("double encoded")))
+	deflateWriter.Close()
+	request, err = NewRequestWithBody("http://localhost:1234/echo", deflateBuffer.Bytes())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.CloseConnection()
+	request.SetHeader("Content-Encoding", "gzip, deflate")
+	response, err = client.POST(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body, _ = io.ReadAll(response.GetBody())
+	if response.StatusCode != STATUS_OK || string(body) != "double encoded" {
+		t.Fatalf("Wrong decompressed body %s", body)
+	}
+}
+
+func TestRequestDecompressionErrors(t *testing.T) {
+	tearDown := setupDecompressionServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequestWithBody("http://localhost:1234/echo", []byte("compressed with brotli"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetHeader("Content-Encoding", "br")
+	response, err := client.POST(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_UNSUPPORTED_MEDIA_TYPE || !response.HasHeaderValue("Accept-Encoding", "gzip") {
+		t.Fatalf("Got wrong STATUS %d\n", response.StatusCode)
+	}
+
+	request, err = NewRequestWithBody("http://localhost:1234/echo", gzipBytes(make([]byte, 1024*1024)))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetHeader("Content-Encoding", "gzip")
+	response, err = client.POST(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_CONTENT_TOO_LARGE {
+		t.Fatalf("Got wrong STATUS %d\n", response.StatusCode)
+	}
+}
+
+func TestRequestDecompressionDisabled(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	compressedBody := gzipBytes([]byte("telemetry payload"))
+	request, err := NewRequestWithBody("http://localhost:1234/large", compressedBody)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.CloseConnection()
+	request.SetHeader("Content-Encoding", "gzip")
+	response, err := client.POST(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body, _ := io.ReadAll(response.GetBody())
+	if !bytes.Equal(body, compressedBody) {
+		t.Fatalf("Body should not be decompressed")
+	}
+}
@@ -0,0 +1,238 @@
+package easyhttp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Resolver that answers every lookup with fixed addresses
+type staticResolver struct {
+	addresses []string
+}
+
+func (r staticResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	var ipAddresses []net.IPAddr
+	for _, address := range r.addresses {
+		ipAddresses = append(ipAddresses, net.IPAddr{IP: net.ParseIP(address)})
+	}
+	return ipAddresses, nil
+}
+
+// Answers a single request read from the connection with responseBytes
+func serveOneRequest(connection net.Conn, responseBytes string) {
+	defer connection.Close()
+	if _, err := http.ReadRequest(bufio.NewReader(connection)); err == nil {
+		connection.Write([]byte(responseBytes))
+	}
+}
+
+func TestDialerHostOverrides(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	client := NewHTTPClient()
+	dialer := NewDialer()
+	dialer.HostOverrides["service.test"] = "127.0.0.1"
+	dialer.HostOverrides["other.test:80"] = "127.0.0.1:1234"
+	client.DialContext = dialer.DialContext
+
+	for _, uri := range []string{"http://service.test:1234/path", "http://other.test/path"} {
+		request, err := NewRequest(uri)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		response, err := client.GET(request)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if response.StatusCode != STATUS_OK || !response.HasHeaderValue("TestHeader", "Hello") {
+			t.Errorf("Test failed. URI: %s; Got status: %d\n", uri, response.StatusCode)
+		}
+	}
+}
+
+func TestDialerUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+	go func() {
+		connection, err := listener.Accept()
+		if err == nil {
+			serveOneRequest(connection, "HTTP/1.1 200 OK\r\nContent-Length: 11\r\nConnection: close\r\n\r\nfrom socket")
+		}
+	}()
+
+	client := NewHTTPClient()
+	dialer := NewDialer()
+	dialer.HostOverrides["app.internal"] = "unix://" + socketPath
+	client.DialContext = dialer.DialContext
+
+	request, err := NewRequest("http://app.internal/status")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body, _ := io.ReadAll(response)
+	if string(body) != "from socket" {
+		t.Fatalf("Wrong body %s\n", body)
+	}
+}
+
+func TestDialerFallsBackOnFailure(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	client := NewHTTPClient()
+	dialer := NewDialer()
+	// Nothing listens on the first address, so the second one is dialed right after it fails
+	dialer.Resolver = staticResolver{addresses: []string{"127.0.0.3", "127.0.0.1"}}
+	dialer.FallbackDelay = time.Hour
+	client.DialContext = dialer.DialContext
+
+	request, err := NewRequest("http://fallback.test:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_OK {
+		t.Fatalf("Wrong status %d\n", response.StatusCode)
+	}
+}
+
+func TestDialerRacesSlowAddress(t *testing.T) {
+	dialer := NewDialer()
+	dialer.FallbackDelay = 50 * time.Millisecond
+	slowAttemptCancelled := make(chan bool, 1)
+	dial := func(ctx context.Context, network string, address string) (net.Conn, error) {
+		if address == "slow:80" {
+			<-ctx.Done()
+			slowAttemptCancelled <- true
+			return nil, ctx.Err()
+		}
+		clientConnection, _ := net.Pipe()
+		return clientConnection, nil
+	}
+
+	start := time.Now()
+	connection, err := dialer.race(context.Background(), dial, "tcp", []string{"slow:80", "fast:80"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	connection.Close()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("Fallback address was dialed after %v\n", elapsed)
+	}
+	select {
+	case <-slowAttemptCancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("Slow attempt was not cancelled")
+	}
+}
+
+func TestDialerLocalAddress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:1238")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+	remoteAddresses := make(chan string, 1)
+	go func() {
+		connection, err := listener.Accept()
+		if err == nil {
+			host, _, _ := net.SplitHostPort(connection.RemoteAddr().String())
+			remoteAddresses <- host
+			serveOneRequest(connection, "HTTP/1.1 204 No Content\r\nConnection: close\r\n\r\n")
+		}
+	}()
+
+	client := NewHTTPClient()
+	dialer := NewDialer()
+	dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP("127.0.0.2")}
+	client.DialContext = dialer.DialContext
+
+	request, err := NewRequest("http://127.0.0.1:1238/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err = client.GET(request); err != nil {
+		t.Fatal(err.Error())
+	}
+	if address := <-remoteAddresses; address != "127.0.0.2" {
+		t.Fatalf("Connection was not bound to the local address. Got %s\n", address)
+	}
+}
+
+func TestClientWithPipe(t *testing.T) {
+	client := NewHTTPClient()
+	client.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		clientConnection, serverConnection := net.Pipe()
+		go serveOneRequest(serverConnection, "HTTP/1.1 200 OK\r\nContent-Length: 9\r\nConnection: close\r\n\r\nin memory")
+		return clientConnection, nil
+	}
+
+	request, err := NewRequest("http://memory.test/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body, _ := io.ReadAll(response)
+	if string(body) != "in memory" {
+		t.Fatalf("Wrong body %s\n", body)
+	}
+}
+
+type InterleaveTest struct {
+	addresses []string
+	network   string
+	expected  []string
+}
+
+var interleaveTests = []InterleaveTest{
+	{addresses: []string{"::1", "::2", "10.0.0.1", "10.0.0.2"}, network: "tcp", expected: []string{"::1", "10.0.0.1", "::2", "10.0.0.2"}},
+	{addresses: []string{"10.0.0.1", "10.0.0.2", "::1"}, network: "tcp", expected: []string{"10.0.0.1", "::1", "10.0.0.2"}},
+	{addresses: []string{"::1", "10.0.0.1", "10.0.0.2"}, network: "tcp4", expected: []string{"10.0.0.1", "10.0.0.2"}},
+	{addresses: []string{"::1", "10.0.0.1", "::2"}, network: "tcp6", expected: []string{"::1", "::2"}},
+}
+
+func TestInterleaveAddresses(t *testing.T) {
+	for _, test := range interleaveTests {
+		ordered := interleaveAddresses(staticResolverAddresses(test.addresses), test.network)
+		var got []string
+		for _, address := range ordered {
+			got = append(got, address.IP.String())
+		}
+		if len(got) != len(test.expected) {
+			t.Errorf("Test failed. Addresses: %v; Expected: %v; Got: %v\n", test.addresses, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("Test failed. Addresses: %v; Expected: %v; Got: %v\n", test.addresses, test.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func staticResolverAddresses(addresses []string) []net.IPAddr {
+	ipAddresses, _ := staticResolver{addresses: addresses}.LookupIPAddr(context.Background(), "")
+	return ipAddresses
+}
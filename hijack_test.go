@@ -0,0 +1,193 @@
+package easyhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func handleHijack(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	connection, _, err := response.Hijack()
+	if err != nil {
+		response.SetStatus(STATUS_INTERNAL_ERROR)
+		return
+	}
+	defer connection.Close()
+	connection.Write([]byte("HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 8\r\n\r\nhijacked"))
+}
+
+func handleUpgrade(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	connection, reader, err := response.Upgrade("echo")
+	if err != nil {
+		response.SetStatus(STATUS_BAD_REQUEST)
+		return
+	}
+	defer connection.Close()
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	connection.Write([]byte(strings.ToUpper(line)))
+}
+
+func handleConnect(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	target, err := net.Dial("tcp", request.Host())
+	if err != nil {
+		response.SetStatus(STATUS_BAD_GATEWAY)
+		return
+	}
+	defer target.Close()
+	connection, reader, err := response.Hijack()
+	if err != nil {
+		return
+	}
+	defer connection.Close()
+	connection.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	go io.Copy(target, reader)
+	io.Copy(connection, target)
+}
+
+func TestHijack(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	response, err := http.Get("http://localhost:1234/hijack")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != STATUS_OK || string(body) != "hijacked" {
+		t.Fatalf("Wrong hijacked response %d %s", response.StatusCode, body)
+	}
+}
+
+func TestHijackedConnectionIsReleased(t *testing.T) {
+	server, err := NewHTTPServer(":1234")
+	if err != nil {
+		t.Fatalf("Error creating HTTP Server")
+	}
+	var hijackedConnections = make(chan net.Conn, 1)
+	server.HandleGET("/hold", func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+		connection, _, err := response.Hijack()
+		if err == nil {
+			hijackedConnections <- connection
+		}
+	})
+	go server.Run()
+
+	connection, err := net.Dial("tcp", "localhost:1234")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer connection.Close()
+	connection.Write([]byte("GET /hold HTTP/1.1\r\nHost: localhost:1234\r\n\r\n"))
+	var hijacked net.Conn
+	select {
+	case hijacked = <-hijackedConnections:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Connection was not hijacked")
+	}
+	defer hijacked.Close()
+
+	var shutdown = make(chan error, 1)
+	go func() {
+		shutdown <- server.GracefullShutdown()
+	}()
+	select {
+	case <-shutdown:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Shutdown waited for the hijacked connection")
+	}
+
+	hijacked.Write([]byte("still open\n"))
+	line, err := bufio.NewReader(connection).ReadString('\n')
+	if err != nil || line != "still open\n" {
+		t.Fatalf("Hijacked connection was closed by the server: %q %v", line, err)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	connection, err := net.Dial("tcp", "localhost:1234")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer connection.Close()
+	connection.Write([]byte("GET /upgrade HTTP/1.1\r\nHost: localhost:1234\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	reader := bufio.NewReader(connection)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_SWITCHING_PROTOCOL || response.Header.Get("Upgrade") != "echo" || response.Header.Get("Content-Length") != "" {
+		t.Fatalf("Wrong upgrade response %d %v", response.StatusCode, response.Header)
+	}
+	connection.Write([]byte("upgraded\n"))
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "UPGRADED\n" {
+		t.Fatalf("Wrong reply on upgraded connection %q %v", line, err)
+	}
+
+	httpResponse, err := http.Get("http://localhost:1234/upgrade")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if httpResponse.StatusCode != STATUS_BAD_REQUEST {
+		t.Fatalf("Upgrade without Upgrade header returned %d", httpResponse.StatusCode)
+	}
+}
+
+func TestConnectTunnel(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	connection, err := net.Dial("tcp", "localhost:1234")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer connection.Close()
+	connection.Write([]byte("CONNECT localhost:1234 HTTP/1.1\r\nHost: localhost:1234\r\n\r\n"))
+	reader := bufio.NewReader(connection)
+	statusLine, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(statusLine, "HTTP/1.1 200") {
+		t.Fatalf("Wrong CONNECT response %q %v", statusLine, err)
+	}
+	if emptyLine, _ := reader.ReadString('\n'); emptyLine != "\r\n" {
+		t.Fatalf("CONNECT response has headers %q", emptyLine)
+	}
+
+	connection.Write([]byte("GET /path HTTP/1.1\r\nHost: localhost:1234\r\nConnection: close\r\n\r\n"))
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != STATUS_OK || string(body) != "Hello World!\n" {
+		t.Fatalf("Wrong response through tunnel %d %s", response.StatusCode, body)
+	}
+}
+
+func TestConnectBadTarget(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	connection, err := net.Dial("tcp", "localhost:1234")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer connection.Close()
+	connection.Write([]byte("CONNECT /path HTTP/1.1\r\nHost: localhost:1234\r\n\r\n"))
+	response, err := http.ReadResponse(bufio.NewReader(connection), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_BAD_REQUEST {
+		t.Fatalf("Expected status %d. Got %d", STATUS_BAD_REQUEST, response.StatusCode)
+	}
+}
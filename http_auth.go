@@ -0,0 +1,412 @@
+package easyhttp
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"maps"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checks the username and password of a request. Passwords must be compared in constant time, as StaticCredentials does
+type CredentialChecker func(username string, password string) bool
+
+// Returns a checker for a fixed set of users and their passwords
+func StaticCredentials(users map[string]string) CredentialChecker {
+	var hashes = make(map[string][32]byte, len(users))
+	for username, password := range users {
+		hashes[username] = sha256.Sum256([]byte(password))
+	}
+	return func(username string, password string) bool {
+		expected, found := hashes[username]
+		// Unknown users are compared too, so they take as long as wrong passwords
+		received := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare(expected[:], received[:]) == 1 && found
+	}
+}
+
+// Middleware that requires HTTP Basic authentication as defined in RFC 7617.
+// Requests without valid credentials get a 401 with a challenge for the realm and the handler does not run
+func BasicAuth(realm string, checker CredentialChecker) Middleware {
+	var challenge = fmt.Sprintf("Basic realm=%s, charset=\"UTF-8\"", quoteAuthParam(realm))
+	return func(next ResponseFunction) ResponseFunction {
+		return func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+			username, password, ok := request.BasicAuth()
+			if !ok || !checker(username, password) {
+				response.SetStatus(STATUS_UNAUTHORIZED)
+				response.SetHeader("WWW-Authenticate", challenge)
+				return
+			}
+			request.authenticatedUser = username
+			next(request, response)
+		}
+	}
+}
+
+// Returns the credentials of a Basic Authorization header
+func (r *ServerHTTPRequest) BasicAuth() (string, string, bool) {
+	scheme, credentials, _ := strings.Cut(strings.TrimSpace(joinHeaderValues(r.GetHeader("Authorization"))), " ")
+	if !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(credentials))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// Returns the user authenticated by the BasicAuth or DigestAuth middleware, or an empty string
+func (r *ServerHTTPRequest) AuthenticatedUser() string {
+	return r.authenticatedUser
+}
+
+const DEFAULT_DIGEST_NONCE_LIFETIME = 5 * time.Minute
+
+// Options used by the DigestAuth middleware
+type DigestAuthOptions struct {
+	Realm string
+	// Returns the hex SHA-256 of username:realm:password, as made by DigestHA1, so passwords need not be kept
+	HA1 func(username string) (string, bool)
+	// Time a nonce can be used before the client is asked to get a new one. DEFAULT_DIGEST_NONCE_LIFETIME is used if zero
+	NonceLifetime time.Duration
+}
+
+// Returns the hash of the credentials that DigestAuthOptions.HA1 returns
+func DigestHA1(username string, realm string, password string) string {
+	return digestHash(sha256.New, username+":"+realm+":"+password)
+}
+
+type digestNonce struct {
+	issued time.Time
+	// Nonce counts already received, so requests can not be replayed
+	counts map[uint64]bool
+}
+
+type digestNonces struct {
+	mutex     sync.Mutex
+	nonces    map[string]*digestNonce
+	lifetime  time.Duration
+	lastPrune time.Time
+}
+
+func (d *digestNonces) issue() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	var now = time.Now()
+	if now.Sub(d.lastPrune) > d.lifetime {
+		for nonce, issued := range d.nonces {
+			if now.Sub(issued.issued) > d.lifetime {
+				delete(d.nonces, nonce)
+			}
+		}
+		d.lastPrune = now
+	}
+	var random = make([]byte, 24)
+	rand.Read(random)
+	nonce := base64.RawURLEncoding.EncodeToString(random)
+	d.nonces[nonce] = &digestNonce{issued: now, counts: make(map[uint64]bool)}
+	return nonce
+}
+
+// Checks the nonce is known and not expired and that the count was not used before with it.
+// Counts can arrive in any order, so pipelined and concurrent requests sharing a nonce are accepted.
+// Returns if the count was accepted and if the nonce is stale, meaning the client only needs a new nonce
+func (d *digestNonces) use(nonce string, count uint64) (bool, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	issued, found := d.nonces[nonce]
+	if !found {
+		return false, true
+	}
+	if time.Since(issued.issued) > d.lifetime {
+		delete(d.nonces, nonce)
+		return false, true
+	}
+	if issued.counts[count] {
+		return false, false
+	}
+	issued.counts[count] = true
+	return true, false
+}
+
+// Middleware that requires HTTP Digest authentication as defined in RFC 7616, with SHA-256 and qop=auth.
+// Nonces expire after the nonce lifetime and every nonce count is accepted once, so captured requests can not be replayed.
+// Usernames must be sent in the clear: the challenge has userhash=false and credentials with userhash=true are rejected
+func DigestAuth(options DigestAuthOptions) Middleware {
+	if options.NonceLifetime <= 0 {
+		options.NonceLifetime = DEFAULT_DIGEST_NONCE_LIFETIME
+	}
+	var nonces = &digestNonces{nonces: make(map[string]*digestNonce), lifetime: options.NonceLifetime, lastPrune: time.Now()}
+	var opaque = make([]byte, 16)
+	rand.Read(opaque)
+	var opaqueValue = hex.EncodeToString(opaque)
+
+	return func(next ResponseFunction) ResponseFunction {
+		return func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+			username, ok, stale := verifyDigest(request, options, nonces, opaqueValue)
+			if !ok {
+				challenge := fmt.Sprintf("Digest realm=%s, qop=\"auth\", algorithm=SHA-256, nonce=\"%s\", opaque=\"%s\", userhash=false",
+					quoteAuthParam(options.Realm), nonces.issue(), opaqueValue)
+				if stale {
+					challenge += ", stale=true"
+				}
+				response.SetStatus(STATUS_UNAUTHORIZED)
+				response.SetHeader("WWW-Authenticate", challenge)
+				return
+			}
+			request.authenticatedUser = username
+			next(request, response)
+		}
+	}
+}
+
+// Returns the user if the Authorization header has a valid digest and if a valid digest used a stale nonce
+func verifyDigest(request ServerHTTPRequest, options DigestAuthOptions, nonces *digestNonces, opaque string) (string, bool, bool) {
+	challenges := parseAuthChallenges(request.GetHeader("Authorization"))
+	if len(challenges) != 1 || challenges[0].scheme != "digest" {
+		return "", false, false
+	}
+	params := challenges[0].params
+	if params["realm"] != options.Realm || !strings.EqualFold(params["algorithm"], "SHA-256") || params["qop"] != "auth" {
+		return "", false, false
+	}
+	if params["opaque"] != opaque || strings.EqualFold(params["userhash"], "true") {
+		return "", false, false
+	}
+	digestURI, err := url.Parse(params["uri"])
+	if err != nil || digestURI.RequestURI() != request.uri.RequestURI() {
+		return "", false, false
+	}
+	count, err := strconv.ParseUint(params["nc"], 16, 64)
+	if err != nil || params["cnonce"] == "" {
+		return "", false, false
+	}
+	ha1, found := options.HA1(params["username"])
+	if !found {
+		return "", false, false
+	}
+	ha2 := digestHash(sha256.New, request.method+":"+params["uri"])
+	expected := digestHash(sha256.New, strings.Join([]string{ha1, params["nonce"], params["nc"], params["cnonce"], "auth", ha2}, ":"))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(params["response"]))) != 1 {
+		return "", false, false
+	}
+	valid, stale := nonces.use(params["nonce"], count)
+	return params["username"], valid, stale
+}
+
+func digestHash(newHash func() hash.Hash, value string) string {
+	digest := newHash()
+	digest.Write([]byte(value))
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// Challenge of a WWW-Authenticate field or credentials of an Authorization field
+type authChallenge struct {
+	// Lowercase scheme
+	scheme string
+	params map[string]string
+}
+
+// Parses the challenges of the fields, which can hold several challenges separated by commas as defined in RFC 9110 section 11.6.1.
+// A token68 like the credentials of Basic is kept under an empty parameter name
+func parseAuthChallenges(values []string) []authChallenge {
+	var challenges []authChallenge
+	for _, value := range values {
+		for _, item := range splitOutsideQuotes(value, ',') {
+			item = strings.TrimSpace(item)
+			scheme, rest, _ := strings.Cut(item, " ")
+			if item == "" {
+				continue
+			}
+			// An item starts a new challenge when its first word is not a parameter
+			if !strings.Contains(scheme, "=") && !strings.HasPrefix(strings.TrimSpace(rest), "=") {
+				challenges = append(challenges, authChallenge{scheme: strings.ToLower(scheme), params: make(map[string]string)})
+				item = strings.TrimSpace(rest)
+				if item == "" {
+					continue
+				}
+			}
+			if len(challenges) == 0 {
+				continue
+			}
+			var params = challenges[len(challenges)-1].params
+			name, paramValue, found := strings.Cut(item, "=")
+			if !found || strings.TrimRight(item, "=") == name {
+				// token68 only ends with padding, like Basic dXNlcjpwYXNz or Bearer ab==
+				params[""] = item
+				continue
+			}
+			params[strings.ToLower(strings.TrimSpace(name))] = unquoteAuthParam(strings.TrimSpace(paramValue))
+		}
+	}
+	return challenges
+}
+
+func quoteAuthParam(value string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(value) + "\""
+}
+
+func unquoteAuthParam(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	var builder strings.Builder
+	var escaped = false
+	for _, character := range value[1 : len(value)-1] {
+		if character == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		builder.WriteRune(character)
+	}
+	return builder.String()
+}
+
+// Sets the credentials used to answer Basic and Digest challenges. Credentials on the uri are used if not set
+func (r *ClientHTTPRequest) SetCredentials(username string, password string) {
+	r.username = username
+	r.password = password
+	r.hasCredentials = true
+}
+
+func (r *ClientHTTPRequest) credentials() (string, string, bool) {
+	if r.hasCredentials {
+		return r.username, r.password, true
+	}
+	if r.uri.User != nil {
+		password, _ := r.uri.User.Password()
+		return r.uri.User.Username(), password, true
+	}
+	return "", "", false
+}
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"":             md5.New,
+	"md5":          md5.New,
+	"md5-sess":     md5.New,
+	"sha-256":      sha256.New,
+	"sha-256-sess": sha256.New,
+}
+
+// Returns the Authorization value answering the strongest supported challenge of a 401 response, or false if none is supported
+func answerChallenge(request *ClientHTTPRequest, response *ClientHTTPResponse) (string, bool) {
+	username, password, ok := request.credentials()
+	if !ok {
+		return "", false
+	}
+	var basic, digest *authChallenge
+	for _, challenge := range parseAuthChallenges(response.GetHeader("WWW-Authenticate")) {
+		switch challenge.scheme {
+		case "basic":
+			if basic == nil {
+				basic = &challenge
+			}
+		case "digest":
+			algorithm := strings.ToLower(challenge.params["algorithm"])
+			if _, supported := digestAlgorithms[algorithm]; !supported {
+				continue
+			}
+			if digest == nil || strings.HasPrefix(algorithm, "sha-256") && !strings.HasPrefix(strings.ToLower(digest.params["algorithm"]), "sha-256") {
+				digest = &challenge
+			}
+		}
+	}
+	if digest != nil {
+		return digestAuthorization(request, digest.params, username, password)
+	}
+	if basic != nil {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)), true
+	}
+	return "", false
+}
+
+func digestAuthorization(request *ClientHTTPRequest, params map[string]string, username string, password string) (string, bool) {
+	algorithm := strings.ToLower(params["algorithm"])
+	newHash, supported := digestAlgorithms[algorithm]
+	if !supported {
+		return "", false
+	}
+	realm, nonce := params["realm"], params["nonce"]
+	var qop = ""
+	for _, offered := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(offered) == "auth" {
+			qop = "auth"
+		}
+	}
+	if params["qop"] != "" && qop == "" {
+		// Only auth-int is offered, which needs the whole body
+		return "", false
+	}
+
+	var cnonceBytes = make([]byte, 16)
+	rand.Read(cnonceBytes)
+	cnonce := hex.EncodeToString(cnonceBytes)
+	const count = "00000001"
+	uri := request.uri.RequestURI()
+
+	ha1 := digestHash(newHash, username+":"+realm+":"+password)
+	if strings.HasSuffix(algorithm, "-sess") {
+		ha1 = digestHash(newHash, ha1+":"+nonce+":"+cnonce)
+	}
+	ha2 := digestHash(newHash, request.method+":"+uri)
+	var digestResponse string
+	if qop == "" {
+		digestResponse = digestHash(newHash, ha1+":"+nonce+":"+ha2)
+	} else {
+		digestResponse = digestHash(newHash, strings.Join([]string{ha1, nonce, count, cnonce, qop, ha2}, ":"))
+	}
+
+	var sentUsername = username
+	if strings.EqualFold(params["userhash"], "true") {
+		sentUsername = digestHash(newHash, username+":"+realm)
+	}
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Digest username=%s, realm=%s, nonce=%s, uri=%s, response=\"%s\"",
+		quoteAuthParam(sentUsername), quoteAuthParam(realm), quoteAuthParam(nonce), quoteAuthParam(uri), digestResponse)
+	if algorithm != "" {
+		builder.WriteString(", algorithm=" + params["algorithm"])
+	}
+	if qop != "" {
+		fmt.Fprintf(&builder, ", qop=%s, nc=%s, cnonce=\"%s\"", qop, count, cnonce)
+	}
+	if opaque, found := params["opaque"]; found {
+		builder.WriteString(", opaque=" + quoteAuthParam(opaque))
+	}
+	if strings.EqualFold(params["userhash"], "true") {
+		builder.WriteString(", userhash=true")
+	}
+	return builder.String(), true
+}
+
+// Sends the request again answering the challenge of a 401 response if the request has credentials and no Authorization header.
+// Returns the response unchanged otherwise
+func (c *httpClient) authenticate(ctx context.Context, request *ClientHTTPRequest, response *ClientHTTPResponse) (*ClientHTTPResponse, error) {
+	if response.StatusCode != STATUS_UNAUTHORIZED || request.GetHeader("Authorization") != nil || !request.replayableBody() {
+		return response, nil
+	}
+	authorization, ok := answerChallenge(request, response)
+	if !ok {
+		return response, nil
+	}
+	response.Body().Close()
+	if err := request.rewindBody(); err != nil {
+		return nil, err
+	}
+	// The header goes on a copy, as a digest only answers a challenge for this uri
+	authenticated := *request
+	authenticated.headers = maps.Clone(request.headers)
+	authenticated.SetHeader("Authorization", authorization)
+	return c.roundTripWithRetries(ctx, &authenticated)
+}
@@ -1,26 +1,75 @@
 package easyhttp
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
-	"io"
+	"fmt"
+	"maps"
 	"net"
+	"net/textproto"
 	"net/url"
+	"strings"
 	"time"
 )
 
 type httpClient struct {
-	activeConnections map[string]net.Conn
-	TLSConfig         *tls.Config
-	MaxRedirects      uint8
-	*CookieStorage
+	pool         *connectionPool
+	breakers     *circuitBreakers
+	TLSConfig    *tls.Config
+	MaxRedirects uint8
+	// Maximum number of idle connections kept per host. DEFAULT_MAX_IDLE_PER_HOST is used if zero
+	MaxIdlePerHost int
+	// Maximum number of open connections per host. Requests wait for a free connection when it is reached. No limit if zero
+	MaxConnsPerHost int
+	// Time an idle connection is kept before being closed. Idle connections never expire if zero
+	IdleConnTimeout time.Duration
+	// Maximum time a connection is used since it was opened. No limit if zero
+	MaxConnLifetime time.Duration
+	// Called before following a redirect with the next request and the requests already sent, oldest first.
+	// Returning ErrUseLastResponse returns the redirect response and any other error is returned by the request
+	CheckRedirect func(request ClientHTTPRequest, via []ClientHTTPRequest) error
+	// Enables a circuit breaker per host that fails requests fast while the host is unhealthy. Disabled if nil
+	CircuitBreaker *CircuitBreakerSettings
+	// Retries failed requests. Requests are not retried if nil, except once when a pooled connection was closed by the server
+	Retry *RetryPolicy
+	// Returns the proxy used for each request. Requests connect directly if nil
+	Proxy ProxyFunction
+	// Opens the connections of the client, like the DialContext of a Dialer or a SOCKS5Dialer. A net.Dialer is used if nil
+	DialContext DialFunction
+	// Maximum time to open a connection. No limit if zero
+	DialTimeout time.Duration
+	// Maximum time of the TLS handshake. No limit if zero
+	TLSHandshakeTimeout time.Duration
+	// Maximum time to wait for the response headers once the request is sent. No limit if zero
+	ResponseHeaderTimeout time.Duration
+	// Maximum time to read the whole response body. No limit if zero
+	ResponseBodyTimeout time.Duration
+	// Stores the cookies received and returns the cookies sent. Cookies are not kept if nil
+	CookieJar
 }
 
 func NewHTTPClient() httpClient {
 	return httpClient{
-		activeConnections: make(map[string]net.Conn),
-		MaxRedirects:      10,
-		CookieStorage:     newCookieStorage(),
+		pool:            newConnectionPool(),
+		breakers:        newCircuitBreakers(),
+		MaxRedirects:    10,
+		IdleConnTimeout: DEFAULT_IDLE_CONN_TIMEOUT,
+		CookieJar:       NewCookieStorage(),
+	}
+}
+
+// Closes every idle connection kept by the client
+func (c *httpClient) CloseIdleConnections() {
+	c.pool.closeIdle()
+}
+
+func (c *httpClient) poolSettings() poolSettings {
+	return poolSettings{
+		maxIdlePerHost:  c.MaxIdlePerHost,
+		maxConnsPerHost: c.MaxConnsPerHost,
+		idleConnTimeout: c.IdleConnTimeout,
+		maxConnLifetime: c.MaxConnLifetime,
 	}
 }
 
@@ -54,11 +103,24 @@ func (c *httpClient) PATCH(request ClientHTTPRequest) (*ClientHTTPResponse, erro
 	return c.sendRequest(request)
 }
 
-func (c *httpClient) sendRequest(request ClientHTTPRequest) (*ClientHTTPResponse, error) {
-	var response *ClientHTTPResponse
-	var redirects uint8 = 0
-	var isRedirect = true
-	for redirects < c.MaxRedirects && isRedirect {
+// Sends the request with the method set by SetMethod, or GET if it has none. Dialing, writing the request and reading the response
+// are aborted once the context is done, returning the context error. Timeouts return ErrClientTimeout
+func (c *httpClient) Do(ctx context.Context, request ClientHTTPRequest) (*ClientHTTPResponse, error) {
+	if request.method == "" {
+		request.method = MethodGet
+	}
+	if !isToken(request.method) {
+		return nil, ErrInvalidMethod
+	}
+	// The request is sent with its own headers and uri, so the caller's request can be reused concurrently
+	request.headers = maps.Clone(request.headers)
+	uri := *request.uri
+	request.uri = &uri
+	var via []ClientHTTPRequest
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if request.uri.Host == "" {
 			host, ok := request.headers["host"]
 			if !ok {
@@ -67,99 +129,342 @@ func (c *httpClient) sendRequest(request ClientHTTPRequest) (*ClientHTTPResponse
 			request.uri.Host = host[0]
 		}
 
-		request.SetHeader("Host", request.uri.Host)
-
-		var connection net.Conn
-		var err error
-
-		connection, exists := c.activeConnections[request.uri.Host]
-		if !exists || !checkIfConnectionIsStillOpen(connection) {
-			if request.uri.Scheme == "https" {
-				connection, err = tls.Dial("tcp", request.uri.Host, c.TLSConfig)
-				if err != nil {
-					return nil, err
-				}
-			} else {
-				connection, err = net.Dial("tcp", request.uri.Host)
-				if err != nil {
-					return nil, err
-				}
-			}
+		response, err := c.roundTripWithRetries(ctx, &request)
+		if err != nil {
+			return nil, err
+		}
+		response, err = c.authenticate(ctx, &request, response)
+		if err != nil {
+			return nil, err
 		}
 
-		request.cookies = c.Cookies(request.uri)
-		requestBytes, err := request.toBytes()
+		next, follow, err := redirectRequest(request, response)
 		if err != nil {
+			response.Body().Close()
 			return nil, err
 		}
-		_, err = connection.Write(requestBytes)
+		if !follow {
+			return response, nil
+		}
+		via = append(via, request)
+		if c.CheckRedirect != nil && len(via) <= int(c.MaxRedirects) {
+			err = c.CheckRedirect(next, via)
+			if err == ErrUseLastResponse {
+				return response, nil
+			}
+		} else if len(via) > int(c.MaxRedirects) {
+			err = errors.New("too many redirects")
+		}
+		response.Body().Close()
 		if err != nil {
 			return nil, err
 		}
+		request = next
+	}
+}
+
+func (c *httpClient) OPTIONS(request ClientHTTPRequest) (*ClientHTTPResponse, error) {
+	request.method = MethodOptions
+	return c.sendRequest(request)
+}
 
-		if request.chunked {
-			request.sendChunks(connection)
+func (c *httpClient) TRACE(request ClientHTTPRequest) (*ClientHTTPResponse, error) {
+	request.method = MethodTrace
+	return c.sendRequest(request)
+}
+
+func (c *httpClient) sendRequest(request ClientHTTPRequest) (*ClientHTTPResponse, error) {
+	return c.Do(context.Background(), request)
+}
+
+// Sends the request on a pooled connection and reads its response. A new connection is dialed if fresh is set
+func (c *httpClient) roundTrip(ctx context.Context, request *ClientHTTPRequest, fresh bool) (*ClientHTTPResponse, error) {
+	request.SetHeader("Host", request.uri.Host)
+
+	request.cookies = c.jarCookies(request.uri, request.initiator, request.method)
+	proxyURL, err := c.proxyFor(request.uri)
+	if err != nil {
+		return nil, err
+	}
+	request.forwardProxy = forwardedThroughProxy(request.uri, proxyURL)
+	request.proxyAuthorization = ""
+	if request.forwardProxy {
+		request.proxyAuthorization = proxyAuthorization(proxyURL)
+	}
+	requestBytes, err := request.toBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var requestDeadline time.Time
+	if request.timeout > 0 {
+		requestDeadline = time.Now().Add(request.timeout)
+	}
+
+	var uri = request.uri
+	var settings = c.poolSettings()
+	connection, err := c.pool.get(ctx, proxiedPoolKey(uri, proxyURL), settings, fresh, func() (net.Conn, error) {
+		return c.dialContext(ctx, uri, proxyURL, requestDeadline)
+	})
+	if err != nil {
+		return nil, requestError(ctx, err, requestDeadline, "dial")
+	}
+
+	// A done context sets a deadline in the past, which aborts any blocked read or write
+	stopCancel := context.AfterFunc(ctx, func() {
+		connection.SetDeadline(time.Unix(1, 0))
+	})
+	// Returns the connection to the pool. Called once the response is read, or by a streamed body once it is consumed
+	release := func(reusable bool) {
+		if !stopCancel() {
+			reusable = false
+		}
+		c.pool.put(connection, reusable, settings)
+	}
+	var reusable = false
+	var streamed = false
+	defer func() {
+		if !streamed {
+			release(reusable)
 		}
+	}()
 
-		if request.timeout > 0 {
-			connection.SetReadDeadline(time.Now().Add(request.timeout))
-		} else {
-			connection.SetReadDeadline(time.Time{})
+	connection.SetWriteDeadline(requestDeadline)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	var bytesReadBefore = connection.bytesRead
+	_, err = connection.Write(requestBytes)
+	if err != nil {
+		if isStaleConnection(ctx, connection, bytesReadBefore, err) {
+			return nil, &staleConnectionError{err}
 		}
-		response, err = parseResponse(connection, request)
-		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				connection.Close()
-				delete(c.activeConnections, request.uri.Host)
-				return nil, ErrClientTimeout
-			}
+		return nil, requestError(ctx, err, requestDeadline, "request write")
+	}
+
+	if request.chunked {
+		err = request.sendChunks(ctx, connection)
+	} else if request.bodyReader != nil {
+		err = request.writeBodyReader(connection)
+	}
+	if err != nil {
+		return nil, requestError(ctx, err, requestDeadline, "request write")
+	}
+	connection.SetWriteDeadline(time.Time{})
+
+	var responseReader = textproto.NewReader(connection.reader)
+	var headerDeadlines = responseDeadlines{ctx: ctx, deadline: phaseDeadline(requestDeadline, c.ResponseHeaderTimeout)}
+	headerDeadlines.apply(connection)
+	response, err := parseResponsefromConnection(responseReader)
+	if err != nil {
+		if isStaleConnection(ctx, connection, bytesReadBefore, err) {
+			return nil, &staleConnectionError{err}
+		}
+		return nil, requestError(ctx, err, requestDeadline, "response headers")
+	}
+	c.storeCookies(request.uri, response.Cookies())
+
+	var bodyDeadlines = responseDeadlines{ctx: ctx, deadline: phaseDeadline(requestDeadline, c.ResponseBodyTimeout)}
+	if !request.eventStream {
+		bodyDeadlines.idleTimeout = KEEP_ALIVE_TIMEOUT * time.Second
+	}
+	if request.streamResponse && request.onResponseChunk == nil && responseHasBody(request, response) {
+		response.stream = &clientResponseBody{
+			response:   response,
+			reader:     responseReader,
+			connection: connection,
+			deadlines:  bodyDeadlines,
+			readError: func(err error) error {
+				return requestError(ctx, err, requestDeadline, "response body")
+			},
+			release: func() {
+				release(canReuseConnection(request, response))
+			},
+		}
+		if err = response.stream.start(); err != nil {
 			return nil, err
 		}
-		c.CookieStorage.SetCookies(request.uri, response.Cookies())
+		streamed = true
+		return response, nil
+	}
+
+	if request.method == MethodHead {
+		// Responses to HEAD never carry a body, whatever their Content-Length says
+		response.bodyComplete = true
+	} else if err = parseResponseBody(response, connection, responseReader, request.onResponseChunk, bodyDeadlines); err != nil {
+		return nil, requestError(ctx, err, requestDeadline, "response body")
+	}
+	reusable = canReuseConnection(request, response)
+	return response, nil
+}
+
+// Returns the earliest of the request deadline and the deadline of a phase starting now
+func phaseDeadline(requestDeadline time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return requestDeadline
+	}
+	var deadline = time.Now().Add(timeout)
+	if !requestDeadline.IsZero() && requestDeadline.Before(deadline) {
+		return requestDeadline
+	}
+	return deadline
+}
+
+// Translates the error of a request. A done context returns its error, the request timeout returns ErrClientTimeout
+// and the timeout of a phase returns ErrClientTimeout wrapped with the name of the phase
+func requestError(ctx context.Context, err error, requestDeadline time.Time, phase string) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		if !requestDeadline.IsZero() && !time.Now().Before(requestDeadline) {
+			return ErrClientTimeout
+		}
+		return fmt.Errorf("%w: %s", ErrClientTimeout, phase)
+	}
+	return err
+}
 
-		if isClosingRequest(&request) {
+// Opens a connection to the host of the uri, or to the proxy if there is one, using TLS for https and wss.
+// Gives up once the context is done or the deadline passes
+func (c *httpClient) dialContext(ctx context.Context, uri *url.URL, proxyURL *url.URL, deadline time.Time) (net.Conn, error) {
+	var dial = c.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	var address = hostWithPort(uri)
+	if proxyURL != nil && isSOCKS5Proxy(proxyURL) {
+		dial = socks5DialerFromURL(proxyURL, dial).DialContext
+	} else if proxyURL != nil {
+		address = hostWithPort(proxyURL)
+	}
+	dialCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if c.DialTimeout > 0 {
+		dialCtx, cancel = context.WithTimeout(dialCtx, c.DialTimeout)
+		defer cancel()
+	}
+	if !deadline.IsZero() {
+		dialCtx, cancel = context.WithDeadline(dialCtx, deadline)
+		defer cancel()
+	}
+	connection, err := dial(dialCtx, "tcp", address)
+	if err != nil {
+		return nil, requestError(ctx, err, deadline, "dial")
+	}
+	if proxyURL != nil && !isSOCKS5Proxy(proxyURL) && !forwardedThroughProxy(uri, proxyURL) {
+		if err = connectTunnel(ctx, connection, uri, proxyURL, deadline); err != nil {
 			connection.Close()
-			delete(c.activeConnections, request.uri.Host)
-		} else {
-			c.activeConnections[request.uri.Host] = connection
-		}
-
-		if isRedirected(response) {
-			var location = response.GetHeader("Location")[0]
-			uri, _ := url.ParseRequestURI(location)
-			if uri.Host != "" {
-				err = request.SetURI(location)
-				if err != nil {
-					return nil, errors.New("bad redirect location")
-				}
-			} else {
-				request.uri.Path = location
-			}
-		} else {
-			isRedirect = false
+			return nil, requestError(ctx, err, deadline, "proxy connect")
 		}
-		redirects++
+	}
+	if uri.Scheme != "https" && uri.Scheme != "wss" {
+		return connection, nil
 	}
 
-	if redirects == c.MaxRedirects {
-		return nil, errors.New("too many redirects")
+	var config = &tls.Config{}
+	if c.TLSConfig != nil {
+		config = c.TLSConfig.Clone()
 	}
+	if config.ServerName == "" {
+		config.ServerName = uri.Hostname()
+	}
+	handshakeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if c.TLSHandshakeTimeout > 0 {
+		handshakeCtx, cancel = context.WithTimeout(handshakeCtx, c.TLSHandshakeTimeout)
+		defer cancel()
+	}
+	if !deadline.IsZero() {
+		handshakeCtx, cancel = context.WithDeadline(handshakeCtx, deadline)
+		defer cancel()
+	}
+	tlsConnection := tls.Client(connection, config)
+	if err = tlsConnection.HandshakeContext(handshakeCtx); err != nil {
+		connection.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if handshakeCtx.Err() != nil {
+			if !deadline.IsZero() && !time.Now().Before(deadline) {
+				return nil, ErrClientTimeout
+			}
+			return nil, fmt.Errorf("%w: %s", ErrClientTimeout, "tls handshake")
+		}
+		return nil, err
+	}
+	return tlsConnection, nil
+}
 
-	return response, nil
+// Returns the host of the uri with the default port of its scheme if it has none
+func hostWithPort(uri *url.URL) string {
+	if uri.Port() != "" {
+		return uri.Host
+	}
+	if uri.Scheme == "https" || uri.Scheme == "wss" {
+		return net.JoinHostPort(uri.Hostname(), "443")
+	}
+	return net.JoinHostPort(uri.Hostname(), "80")
 }
 
 func isRedirected(response *ClientHTTPResponse) bool {
-	return response.StatusCode >= 300 && response.StatusCode < 400
+	switch response.StatusCode {
+	case STATUS_MOVED_PERMANENTLY, STATUS_FOUND, STATUS_SEE_OTHER, STATUS_TEMPORARY_REDIRECT, STATUS_PERMANENT_REDIRECT:
+		return response.ExistsHeader("Location")
+	}
+	return false
 }
 
-func checkIfConnectionIsStillOpen(connection net.Conn) bool {
-	one := make([]byte, 1)
-	connection.SetReadDeadline(time.Now().Add(100 * time.Microsecond))
+// Builds the request that follows a redirect response as defined by RFC 9110. Returns false if the response is not
+// a redirect that can be followed, like a 307 or 308 of a request whose body was streamed and cannot be sent again
+func redirectRequest(request ClientHTTPRequest, response *ClientHTTPResponse) (ClientHTTPRequest, bool, error) {
+	if !isRedirected(response) {
+		return request, false, nil
+	}
+	location, err := url.Parse(strings.Join(response.GetHeader("Location"), ","))
+	if err != nil {
+		return request, false, errors.New("bad redirect location")
+	}
+	var next = request
+	next.uri = request.uri.ResolveReference(location)
+	if next.uri.Scheme != "http" && next.uri.Scheme != "https" || next.uri.Host == "" {
+		return request, false, errors.New("bad redirect location")
+	}
+	next.headers = maps.Clone(request.headers)
+	if next.initiator == nil {
+		next.initiator = request.uri
+	}
+
+	var changeToGet = response.StatusCode == STATUS_SEE_OTHER && request.method != MethodHead ||
+		(response.StatusCode == STATUS_MOVED_PERMANENTLY || response.StatusCode == STATUS_FOUND) && request.method == MethodPost
+	if changeToGet {
+		next.method = MethodGet
+		next.body = nil
+		next.bodyReader = nil
+		next.chunked = false
+		for _, header := range []string{"content-length", "content-type", "content-encoding", "transfer-encoding", "trailer"} {
+			delete(next.headers, header)
+		}
+	} else if request.chunked || request.bodyReader != nil {
+		return request, false, nil
+	}
 
-	if _, err := connection.Read(one); err == io.EOF {
+	if poolKey(request.uri) != poolKey(next.uri) {
+		for _, header := range []string{"authorization", "proxy-authorization", "cookie"} {
+			delete(next.headers, header)
+		}
+		next.username, next.password, next.hasCredentials = "", "", false
+	}
+	return next, true, nil
+}
+
+// Checks if the connection can carry another request once the response was read
+func canReuseConnection(request *ClientHTTPRequest, response *ClientHTTPResponse) bool {
+	if !response.bodyComplete || isClosingRequest(request) || headerContainsToken(response.GetHeader("Connection"), "close") {
+		return false
+	}
+	if response.version == "1.0" && !headerContainsToken(response.GetHeader("Connection"), "keep-alive") {
 		return false
-	} else {
-		connection.SetReadDeadline(time.Time{})
-		return true
 	}
+	return true
 }
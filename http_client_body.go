@@ -0,0 +1,164 @@
+package easyhttp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+var errBodyClosed = errors.New("read on closed response body")
+
+// Body of a streamed client response. Reads go to the connection, which is released once the body is read to the end or closed
+type clientResponseBody struct {
+	mutex      sync.Mutex
+	response   *ClientHTTPResponse
+	reader     *textproto.Reader
+	connection net.Conn
+	deadlines  responseDeadlines
+	// Translates errors of the connection into the errors returned to the reader
+	readError func(error) error
+	// Returns the connection to the pool
+	release func()
+	chunked bool
+	// Set when the body ends when the server closes the connection
+	untilClose bool
+	// Bytes left of the body or of the current chunk
+	remaining int64
+	err       error
+	closed    bool
+}
+
+// Checks if a response carries a body as defined by RFC 9112 section 6.3
+func responseHasBody(request *ClientHTTPRequest, response *ClientHTTPResponse) bool {
+	if request.method == MethodHead || response.StatusCode < 200 || response.StatusCode == STATUS_NO_CONTENT || response.StatusCode == STATUS_NOT_MODIFIED {
+		return false
+	}
+	if response.version == "1.1" && response.HasHeaderValue("Transfer-Encoding", "chunked") {
+		return true
+	}
+	contentLengthHeader := response.GetHeader("Content-Length")
+	return contentLengthHeader == nil || contentLengthHeader[len(contentLengthHeader)-1] != "0"
+}
+
+// Works out how the body is delimited from the response headers
+func (b *clientResponseBody) start() error {
+	if b.response.version == "1.1" && b.response.HasHeaderValue("Transfer-Encoding", "chunked") {
+		b.chunked = true
+		return nil
+	}
+	contentLengthHeader := b.response.GetHeader("Content-Length")
+	if contentLengthHeader == nil {
+		b.untilClose = true
+		return nil
+	}
+	bodyLength, err := strconv.ParseInt(contentLengthHeader[len(contentLengthHeader)-1], 10, 64)
+	if err != nil || bodyLength < 0 {
+		return ErrInvalidLength
+	}
+	b.remaining = bodyLength
+	return nil
+}
+
+func (b *clientResponseBody) Read(buffer []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return 0, errBodyClosed
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	if len(buffer) == 0 {
+		return 0, nil
+	}
+
+	b.deadlines.apply(b.connection)
+	read, err := b.read(buffer)
+	if err == io.EOF {
+		b.err = io.EOF
+		b.release()
+	} else if err != nil {
+		b.err = b.readError(err)
+		b.response.bodyComplete = false
+		b.release()
+		err = b.err
+	}
+	return read, err
+}
+
+func (b *clientResponseBody) read(buffer []byte) (int, error) {
+	if b.untilClose {
+		return b.reader.R.Read(buffer)
+	}
+	if b.chunked && b.remaining == 0 {
+		sizeLine, err := b.reader.ReadLine()
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		chunkLength, extensions, err := parseChunkSizeLine(sizeLine)
+		if err != nil {
+			return 0, err
+		}
+		b.response.chunkExtensions = extensions
+		if chunkLength == 0 {
+			b.response.trailers, err = parseTrailers(b.reader)
+			if err != nil {
+				return 0, unexpectedEOF(err)
+			}
+			b.response.bodyComplete = true
+			return 0, io.EOF
+		}
+		b.remaining = int64(chunkLength)
+	}
+	if b.remaining == 0 {
+		b.response.bodyComplete = true
+		return 0, io.EOF
+	}
+
+	if int64(len(buffer)) > b.remaining {
+		buffer = buffer[:b.remaining]
+	}
+	read, err := b.reader.R.Read(buffer)
+	b.remaining -= int64(read)
+	if err != nil {
+		return read, unexpectedEOF(err)
+	}
+	if b.remaining == 0 {
+		if b.chunked {
+			if err = readChunkEnd(b.reader); err != nil {
+				return read, unexpectedEOF(err)
+			}
+		} else {
+			b.response.bodyComplete = true
+			b.err = io.EOF
+			b.release()
+		}
+	}
+	return read, nil
+}
+
+// Closes the body. A body closed before its end is discarded with its connection
+func (b *clientResponseBody) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	if b.err == nil {
+		b.response.bodyComplete = false
+		b.err = errBodyClosed
+		b.release()
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,301 @@
+package easyhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State of a circuit breaker
+type CircuitState int
+
+const (
+	// Requests flow and their outcomes are recorded
+	CIRCUIT_CLOSED CircuitState = iota
+	// Requests fail fast until the cool-down passes
+	CIRCUIT_OPEN
+	// A limited number of probe requests decide if the circuit closes again
+	CIRCUIT_HALF_OPEN
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CIRCUIT_CLOSED:
+		return "closed"
+	case CIRCUIT_OPEN:
+		return "open"
+	case CIRCUIT_HALF_OPEN:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Matches every CircuitOpenError with errors.Is
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Returned without sending the request while the circuit breaker of its host is open
+type CircuitOpenError struct {
+	// Host whose circuit is open, as scheme://host:port
+	Host string
+	// Time left until the circuit lets probe requests through
+	RetryIn time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for %s, retry in %v", e.Host, e.RetryIn)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Number of buckets the rolling window is split into
+const CIRCUIT_WINDOW_BUCKETS = 10
+
+// Settings of the per host circuit breakers of the client
+type CircuitBreakerSettings struct {
+	// Opens the circuit after this many consecutive failures. Disabled if zero
+	ConsecutiveFailures int
+	// Opens the circuit when the ratio of failures over the window reaches it, between 0 and 1. Disabled if zero
+	FailureRate float64
+	// Minimum number of requests in the window before FailureRate is checked
+	MinimumRequests int
+	// Length of the rolling window used by FailureRate
+	Window time.Duration
+	// Time the circuit stays open before letting probe requests through
+	CoolDown time.Duration
+	// Number of probe requests let through while half-open. All of them must succeed to close the circuit
+	HalfOpenProbes int
+	// Decides if the outcome of a request is a failure. Errors and 5xx statuses are failures if nil
+	IsFailure func(response *ClientHTTPResponse, err error) bool
+}
+
+func NewCircuitBreakerSettings() *CircuitBreakerSettings {
+	return &CircuitBreakerSettings{
+		ConsecutiveFailures: 5,
+		FailureRate:         0.5,
+		MinimumRequests:     20,
+		Window:              time.Minute,
+		CoolDown:            30 * time.Second,
+		HalfOpenProbes:      1,
+	}
+}
+
+func (s *CircuitBreakerSettings) isFailure(response *ClientHTTPResponse, err error) bool {
+	if s.IsFailure != nil {
+		return s.IsFailure(response, err)
+	}
+	return err != nil || response.StatusCode >= 500
+}
+
+type circuitBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+type circuitBreaker struct {
+	state               CircuitState
+	consecutiveFailures int
+	openedAt            time.Time
+	probesInFlight      int
+	probeSuccesses      int
+	buckets             [CIRCUIT_WINDOW_BUCKETS]circuitBucket
+}
+
+// Circuit breakers of the client, one per scheme, host and port. Safe for concurrent use
+type circuitBreakers struct {
+	mutex    sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakers() *circuitBreakers {
+	return &circuitBreakers{breakers: make(map[string]*circuitBreaker)}
+}
+
+// Checks if a request to the host can be sent. The returned attempt must be recorded or skipped once the request ends
+func (b *circuitBreakers) allow(host string, settings *CircuitBreakerSettings) (*circuitAttempt, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	breaker, found := b.breakers[host]
+	if !found {
+		breaker = &circuitBreaker{}
+		b.breakers[host] = breaker
+	}
+
+	var now = time.Now()
+	if breaker.state == CIRCUIT_OPEN {
+		if retryIn := settings.CoolDown - now.Sub(breaker.openedAt); retryIn > 0 {
+			return nil, &CircuitOpenError{Host: host, RetryIn: retryIn}
+		}
+		breaker.state = CIRCUIT_HALF_OPEN
+		breaker.probesInFlight = 0
+		breaker.probeSuccesses = 0
+	}
+	var probe = breaker.state == CIRCUIT_HALF_OPEN
+	if probe {
+		if breaker.probesInFlight+breaker.probeSuccesses >= max(settings.HalfOpenProbes, 1) {
+			return nil, &CircuitOpenError{Host: host}
+		}
+		breaker.probesInFlight++
+	}
+	return &circuitAttempt{breakers: b, breaker: breaker, settings: settings, probe: probe}, nil
+}
+
+// Request let through by a circuit breaker. Only the first call to record or skip has an effect
+type circuitAttempt struct {
+	breakers *circuitBreakers
+	breaker  *circuitBreaker
+	settings *CircuitBreakerSettings
+	probe    bool
+	finished bool
+}
+
+// Records the outcome of the request. Cancellations say nothing about the health of the host, so they are skipped
+func (a *circuitAttempt) record(response *ClientHTTPResponse, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		a.skip()
+		return
+	}
+	a.breakers.mutex.Lock()
+	defer a.breakers.mutex.Unlock()
+	if a.finishLocked() {
+		a.breaker.record(a.settings, a.settings.isFailure(response, err), a.probe, time.Now())
+	}
+}
+
+// Discards the request without recording an outcome, releasing its probe slot if the circuit is half-open
+func (a *circuitAttempt) skip() {
+	a.breakers.mutex.Lock()
+	defer a.breakers.mutex.Unlock()
+	a.finishLocked()
+}
+
+// Marks the attempt as finished and releases its probe slot. Returns false if it was already finished
+func (a *circuitAttempt) finishLocked() bool {
+	if a.finished {
+		return false
+	}
+	a.finished = true
+	if a.probe && a.breaker.state == CIRCUIT_HALF_OPEN {
+		a.breaker.probesInFlight--
+	}
+	return true
+}
+
+func (c *circuitBreaker) record(settings *CircuitBreakerSettings, failed bool, probe bool, now time.Time) {
+	if c.state == CIRCUIT_HALF_OPEN {
+		if !probe {
+			return
+		}
+		if failed {
+			c.open(now)
+			return
+		}
+		c.probeSuccesses++
+		if c.probeSuccesses >= max(settings.HalfOpenProbes, 1) {
+			*c = circuitBreaker{state: CIRCUIT_CLOSED}
+		}
+		return
+	}
+	if c.state != CIRCUIT_CLOSED {
+		return
+	}
+
+	bucket := c.bucket(settings, now)
+	if failed {
+		bucket.failures++
+		c.consecutiveFailures++
+	} else {
+		bucket.successes++
+		c.consecutiveFailures = 0
+	}
+	if settings.ConsecutiveFailures > 0 && c.consecutiveFailures >= settings.ConsecutiveFailures {
+		c.open(now)
+		return
+	}
+	if settings.FailureRate > 0 {
+		successes, failures := c.windowCounts(settings, now)
+		total := successes + failures
+		if total > 0 && total >= settings.MinimumRequests && float64(failures)/float64(total) >= settings.FailureRate {
+			c.open(now)
+		}
+	}
+}
+
+func (c *circuitBreaker) open(now time.Time) {
+	c.state = CIRCUIT_OPEN
+	c.openedAt = now
+	c.consecutiveFailures = 0
+	c.probesInFlight = 0
+	c.probeSuccesses = 0
+	c.buckets = [CIRCUIT_WINDOW_BUCKETS]circuitBucket{}
+}
+
+func bucketLength(settings *CircuitBreakerSettings) time.Duration {
+	return max(settings.Window/CIRCUIT_WINDOW_BUCKETS, time.Millisecond)
+}
+
+// Returns the bucket of the current time, resetting it if it belonged to an older window
+func (c *circuitBreaker) bucket(settings *CircuitBreakerSettings, now time.Time) *circuitBucket {
+	length := bucketLength(settings)
+	start := now.Truncate(length)
+	bucket := &c.buckets[(now.UnixNano()/int64(length))%CIRCUIT_WINDOW_BUCKETS]
+	if !bucket.start.Equal(start) {
+		*bucket = circuitBucket{start: start}
+	}
+	return bucket
+}
+
+func (c *circuitBreaker) windowCounts(settings *CircuitBreakerSettings, now time.Time) (int, int) {
+	var successes, failures int
+	windowStart := now.Add(-bucketLength(settings) * CIRCUIT_WINDOW_BUCKETS)
+	for _, bucket := range c.buckets {
+		if bucket.start.After(windowStart) {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+	return successes, failures
+}
+
+func (b *circuitBreakers) states(settings *CircuitBreakerSettings) map[string]CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	states := make(map[string]CircuitState, len(b.breakers))
+	for host, breaker := range b.breakers {
+		state := breaker.state
+		if state == CIRCUIT_OPEN && settings != nil && time.Since(breaker.openedAt) >= settings.CoolDown {
+			state = CIRCUIT_HALF_OPEN
+		}
+		states[host] = state
+	}
+	return states
+}
+
+// Returns the state of the circuit breaker of every host the client sent requests to, keyed by scheme://host:port
+func (c *httpClient) CircuitStates() map[string]CircuitState {
+	return c.breakers.states(c.CircuitBreaker)
+}
+
+// Sends the request unless the circuit breaker of its host is open, recording the outcome
+func (c *httpClient) roundTripWithBreaker(ctx context.Context, request *ClientHTTPRequest, fresh bool) (*ClientHTTPResponse, error) {
+	if c.CircuitBreaker == nil {
+		return c.roundTrip(ctx, request, fresh)
+	}
+	attempt, err := c.breakers.allow(poolKey(request.uri), c.CircuitBreaker)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.roundTrip(ctx, request, fresh)
+	var staleErr *staleConnectionError
+	if errors.As(err, &staleErr) {
+		// Stale connections are retried, so only the retry is recorded
+		attempt.skip()
+		return response, err
+	}
+	attempt.record(response, err)
+	return response, err
+}
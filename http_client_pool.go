@@ -0,0 +1,243 @@
+package easyhttp
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Default number of idle connections kept per host
+const DEFAULT_MAX_IDLE_PER_HOST = 2
+
+// Default time an idle connection is kept open
+const DEFAULT_IDLE_CONN_TIMEOUT = 90 * time.Second
+
+// Connection managed by the client connection pool
+type pooledConnection struct {
+	net.Conn
+	reader    *bufio.Reader
+	key       string
+	createdAt time.Time
+	// Set while the connection is lent to a request
+	reserved bool
+	// Set once the connection was closed while idle
+	dead        bool
+	watcherDone chan struct{}
+	// Set when the connection was taken from the idle connections
+	reused bool
+	// Number of bytes read from the connection
+	bytesRead int64
+}
+
+func (c *pooledConnection) Read(buffer []byte) (int, error) {
+	read, err := c.Conn.Read(buffer)
+	c.bytesRead += int64(read)
+	return read, err
+}
+
+// Limits applied by the pool, taken from the client on every call
+type poolSettings struct {
+	maxIdlePerHost  int
+	maxConnsPerHost int
+	idleConnTimeout time.Duration
+	maxConnLifetime time.Duration
+}
+
+// Pool of client connections keyed by scheme, host and port. It is safe for concurrent use
+type connectionPool struct {
+	mutex sync.Mutex
+	idle  map[string][]*pooledConnection
+	// Number of open connections per key, idle or in use
+	open map[string]int
+	// Closed and replaced every time a connection is released, waking requests waiting for a free slot
+	released chan struct{}
+}
+
+func newConnectionPool() *connectionPool {
+	return &connectionPool{
+		idle:     make(map[string][]*pooledConnection),
+		open:     make(map[string]int),
+		released: make(chan struct{}),
+	}
+}
+
+func poolKey(uri *url.URL) string {
+	return uri.Scheme + "://" + hostWithPort(uri)
+}
+
+func (s poolSettings) expired(connection *pooledConnection) bool {
+	return s.maxConnLifetime > 0 && time.Since(connection.createdAt) > s.maxConnLifetime
+}
+
+// Returns an idle connection for the key or dials a new one, waiting while the host is at maxConnsPerHost
+// unless the context is done first. Idle connections are skipped if fresh is set
+func (p *connectionPool) get(ctx context.Context, key string, settings poolSettings, fresh bool, dial func() (net.Conn, error)) (*pooledConnection, error) {
+	p.mutex.Lock()
+	for {
+		if fresh {
+			p.closeIdleLocked(key)
+		} else if connection := p.takeIdleLocked(key, settings); connection != nil {
+			p.mutex.Unlock()
+			connection.reused = true
+			return connection, nil
+		}
+		if settings.maxConnsPerHost <= 0 || p.open[key] < settings.maxConnsPerHost {
+			break
+		}
+		released := p.released
+		p.mutex.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		p.mutex.Lock()
+	}
+	p.open[key]++
+	p.mutex.Unlock()
+
+	connection, err := dial()
+	if err != nil {
+		p.mutex.Lock()
+		p.releaseSlotLocked(key)
+		p.mutex.Unlock()
+		return nil, err
+	}
+	pooled := &pooledConnection{
+		Conn:      connection,
+		key:       key,
+		createdAt: time.Now(),
+		reserved:  true,
+	}
+	pooled.reader = bufio.NewReader(pooled)
+	return pooled, nil
+}
+
+// Takes the most recently used idle connection that is still alive. Must be called with the mutex held
+func (p *connectionPool) takeIdleLocked(key string, settings poolSettings) *pooledConnection {
+	for len(p.idle[key]) > 0 {
+		idleConnections := p.idle[key]
+		connection := idleConnections[len(idleConnections)-1]
+		p.idle[key] = idleConnections[:len(idleConnections)-1]
+		if settings.expired(connection) {
+			connection.Conn.Close()
+			p.releaseSlotLocked(key)
+			continue
+		}
+		connection.reserved = true
+
+		// Wake the watcher up and wait for it so only the request reads from the connection
+		p.mutex.Unlock()
+		connection.SetReadDeadline(time.Now())
+		<-connection.watcherDone
+		connection.SetReadDeadline(time.Time{})
+		p.mutex.Lock()
+		if !connection.dead {
+			return connection
+		}
+	}
+	return nil
+}
+
+// Returns a connection to the pool. Connections that cannot be reused are closed
+func (p *connectionPool) put(connection *pooledConnection, reusable bool, settings poolSettings) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	var maxIdle = settings.maxIdlePerHost
+	if maxIdle == 0 {
+		maxIdle = DEFAULT_MAX_IDLE_PER_HOST
+	}
+	if !reusable || settings.expired(connection) || len(p.idle[connection.key]) >= maxIdle {
+		connection.Conn.Close()
+		p.releaseSlotLocked(connection.key)
+		return
+	}
+	connection.reserved = false
+	connection.watcherDone = make(chan struct{})
+	if settings.idleConnTimeout > 0 {
+		connection.SetReadDeadline(time.Now().Add(settings.idleConnTimeout))
+	} else {
+		connection.SetReadDeadline(time.Time{})
+	}
+	p.idle[connection.key] = append(p.idle[connection.key], connection)
+	go p.watch(connection)
+	p.notifyLocked()
+}
+
+// Waits on an idle connection until it receives data, is closed by the server or stays idle for too long.
+// Any of those makes the connection unusable, so it is removed from the pool
+func (p *connectionPool) watch(connection *pooledConnection) {
+	defer close(connection.watcherDone)
+	_, err := connection.reader.Peek(1)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if connection.reserved {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return
+		}
+	} else {
+		idleConnections := p.idle[connection.key]
+		for i, idleConnection := range idleConnections {
+			if idleConnection == connection {
+				p.idle[connection.key] = append(idleConnections[:i], idleConnections[i+1:]...)
+				break
+			}
+		}
+	}
+	connection.dead = true
+	connection.Conn.Close()
+	p.releaseSlotLocked(connection.key)
+}
+
+func (p *connectionPool) releaseSlotLocked(key string) {
+	p.open[key]--
+	if p.open[key] <= 0 {
+		delete(p.open, key)
+	}
+	p.notifyLocked()
+}
+
+func (p *connectionPool) notifyLocked() {
+	close(p.released)
+	p.released = make(chan struct{})
+}
+
+// Closes the idle connections of the key, which might be as stale as one that just failed.
+// Their watchers release the slots. Must be called with the mutex held
+func (p *connectionPool) closeIdleLocked(key string) {
+	for _, connection := range p.idle[key] {
+		connection.reserved = true
+		connection.Conn.Close()
+	}
+	delete(p.idle, key)
+}
+
+// Closes every idle connection of the pool
+func (p *connectionPool) closeIdle() {
+	p.mutex.Lock()
+	var idleConnections []*pooledConnection
+	for key, connections := range p.idle {
+		idleConnections = append(idleConnections, connections...)
+		delete(p.idle, key)
+	}
+	for _, connection := range idleConnections {
+		connection.reserved = true
+	}
+	p.mutex.Unlock()
+
+	for _, connection := range idleConnections {
+		connection.SetReadDeadline(time.Now())
+		<-connection.watcherDone
+		p.mutex.Lock()
+		if !connection.dead {
+			connection.dead = true
+			connection.Conn.Close()
+			p.releaseSlotLocked(connection.key)
+		}
+		p.mutex.Unlock()
+	}
+}
@@ -0,0 +1,172 @@
+package easyhttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Returned, wrapped with the reason, when a proxy does not open a CONNECT tunnel
+var ErrProxyTunnel = errors.New("proxy tunnel failed")
+
+// Function that returns the proxy used for a request uri or nil to connect directly.
+// Supports http proxies and SOCKS5 proxies with the socks5 and socks5h schemes
+type ProxyFunction func(uri *url.URL) (*url.URL, error)
+
+// Returns a ProxyFunction that sends every request through the proxy
+func ProxyURL(proxy *url.URL) ProxyFunction {
+	return func(uri *url.URL) (*url.URL, error) {
+		return proxy, nil
+	}
+}
+
+// ProxyFunction that reads the proxy from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, or their
+// lowercase versions. HTTPS_PROXY is used for https and wss requests and HTTP_PROXY for the rest.
+// NO_PROXY is a comma separated list of hosts, domains, IP addresses or CIDR blocks reached directly, or * for all of them
+func ProxyFromEnvironment(uri *url.URL) (*url.URL, error) {
+	var proxy string
+	if uri.Scheme == "https" || uri.Scheme == "wss" {
+		proxy = environmentValue("HTTPS_PROXY")
+	} else {
+		proxy = environmentValue("HTTP_PROXY")
+	}
+	if proxy == "" || bypassProxy(uri, environmentValue("NO_PROXY")) {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil || proxyURL.Host == "" {
+		// Proxies are often written without a scheme, like proxy:3128
+		proxyURL, err = url.Parse("http://" + proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy address %q", proxy)
+		}
+	}
+	return proxyURL, nil
+}
+
+func environmentValue(name string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return os.Getenv(strings.ToLower(name))
+}
+
+// Checks if the uri matches an entry of a NO_PROXY list
+func bypassProxy(uri *url.URL, noProxy string) bool {
+	var host = strings.ToLower(uri.Hostname())
+	_, port, _ := net.SplitHostPort(hostWithPort(uri))
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip := net.ParseIP(host); ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if entryHost, entryPort, err := net.SplitHostPort(entry); err == nil {
+			if entryPort != port {
+				continue
+			}
+			entry = entryHost
+		}
+		entry = strings.Trim(entry, "[]")
+		if host == entry || strings.HasSuffix(host, "."+strings.TrimPrefix(entry, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the proxy used for the uri, if any
+func (c *httpClient) proxyFor(uri *url.URL) (*url.URL, error) {
+	if c.Proxy == nil {
+		return nil, nil
+	}
+	proxyURL, err := c.Proxy(uri)
+	if err != nil || proxyURL == nil {
+		return nil, err
+	}
+	if proxyURL.Scheme != "http" && !isSOCKS5Proxy(proxyURL) {
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	return proxyURL, nil
+}
+
+func isSOCKS5Proxy(proxyURL *url.URL) bool {
+	return proxyURL.Scheme == "socks5" || proxyURL.Scheme == "socks5h"
+}
+
+// Plain http requests are sent to http proxies, every other request is tunnelled through the proxy
+func forwardedThroughProxy(uri *url.URL, proxyURL *url.URL) bool {
+	return proxyURL != nil && proxyURL.Scheme == "http" && uri.Scheme == "http"
+}
+
+// Returns the Proxy-Authorization header value for the credentials of the proxy uri or an empty string if it has none
+func proxyAuthorization(proxyURL *url.URL) string {
+	if proxyURL == nil || proxyURL.User == nil {
+		return ""
+	}
+	password, _ := proxyURL.User.Password()
+	credentials := proxyURL.User.Username() + ":" + password
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+}
+
+// Returns the pool key of connections to the uri through the proxy. Forwarded requests share the connections to the proxy
+func proxiedPoolKey(uri *url.URL, proxyURL *url.URL) string {
+	if proxyURL == nil {
+		return poolKey(uri)
+	}
+	if forwardedThroughProxy(uri, proxyURL) {
+		return "proxy " + poolKey(proxyURL) + " " + proxyAuthorization(proxyURL)
+	}
+	return poolKey(uri) + " via " + poolKey(proxyURL) + " " + proxyAuthorization(proxyURL)
+}
+
+// Asks the proxy on the connection to open a tunnel to the host of the uri
+func connectTunnel(ctx context.Context, connection net.Conn, uri *url.URL, proxyURL *url.URL, deadline time.Time) error {
+	stopCancel := context.AfterFunc(ctx, func() {
+		connection.SetDeadline(time.Unix(1, 0))
+	})
+	defer stopCancel()
+	connection.SetDeadline(deadline)
+
+	var target = hostWithPort(uri)
+	var builder strings.Builder
+	builder.WriteString("CONNECT " + target + " HTTP/1.1\r\n")
+	builder.WriteString("Host: " + target + "\r\n")
+	if authorization := proxyAuthorization(proxyURL); authorization != "" {
+		builder.WriteString("Proxy-Authorization: " + authorization + "\r\n")
+	}
+	builder.WriteString("\r\n")
+	if _, err := connection.Write([]byte(builder.String())); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(connection)
+	response, err := parseResponsefromConnection(textproto.NewReader(reader))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("%w: proxy answered with status %d", ErrProxyTunnel, response.StatusCode)
+	}
+	if reader.Buffered() > 0 {
+		return fmt.Errorf("%w: proxy sent data before the tunnel was used", ErrProxyTunnel)
+	}
+	connection.SetDeadline(time.Time{})
+	return nil
+}
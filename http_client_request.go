@@ -2,8 +2,10 @@ package easyhttp
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/url"
 	"slices"
@@ -23,6 +25,23 @@ type ClientHTTPRequest struct {
 	chunked         bool
 	onResponseChunk ClientChunkFunction
 	timeout         time.Duration
+	bodyReader      io.Reader
+	// Length of bodyReader or -1 if unknown
+	bodyLength int64
+	// Offset of a seekable bodyReader when it was set, where retries start reading again
+	bodyStart      int64
+	streamResponse bool
+	// Set when the request is sent to a proxy, which needs the absolute uri on the request line
+	forwardProxy       bool
+	proxyAuthorization string
+	// Uri of the request that started a redirect chain, which decides if cookies are sent cross site
+	initiator *url.URL
+	// Credentials used to answer authentication challenges
+	username       string
+	password       string
+	hasCredentials bool
+	trailers       Headers
+	eventStream    bool
 }
 
 func (r *ClientHTTPRequest) SetHeader(key string, value string) {
@@ -80,10 +99,45 @@ func (r *ClientHTTPRequest) SetVersion(version string) error {
 	return errors.New("invalid Version")
 }
 
+// Returns the method of the request. Empty until it is set or the request is sent
+func (r *ClientHTTPRequest) Method() string {
+	return r.method
+}
+
+// Sets the method used by Do. Any token is accepted, so extension methods can be sent. Returns ErrInvalidMethod otherwise
+func (r *ClientHTTPRequest) SetMethod(method string) error {
+	if !isToken(method) {
+		return ErrInvalidMethod
+	}
+	r.method = method
+	return nil
+}
+
+// Sets a body held in memory. Use SetBodyReader to send a body from an io.Reader
 func (r *ClientHTTPRequest) SetBody(body []byte) {
 	r.body = body
 }
 
+// Sets a body read from the reader while the request is sent. A negative length means the length is unknown,
+// in which case the body is sent chunked. Only bodies implementing io.Seeker are retried and 307 and 308 redirects are not followed
+func (r *ClientHTTPRequest) SetBodyReader(reader io.Reader, length int64) {
+	r.bodyReader = reader
+	r.bodyLength = length
+	r.bodyStart = 0
+	r.body = nil
+	delete(r.headers, "content-length")
+	if seeker, ok := reader.(io.Seeker); ok {
+		r.bodyStart, _ = seeker.Seek(0, io.SeekCurrent)
+	}
+}
+
+// Streams the response body from the connection instead of reading it into memory before returning.
+// Streaming is opt-in so callers that never close the body do not keep pooled connections busy.
+// The body returned by Body must be read to the end or closed to release the connection
+func (r *ClientHTTPRequest) StreamResponse() {
+	r.streamResponse = true
+}
+
 func (r *ClientHTTPRequest) SetURI(uri string) error {
 	requestURI, err := url.ParseRequestURI(uri)
 	if err != nil {
@@ -109,30 +163,95 @@ func (r *ClientHTTPRequest) OnChunkFunction(onChunk ClientChunkFunction) {
 	r.onResponseChunk = onChunk
 }
 
-func (r ClientHTTPRequest) sendChunks(connection net.Conn) {
-	for chunk := range r.chunkChannel {
-		buffer := new(bytes.Buffer)
-		chunkLength := fmt.Sprintf("%x \r\n", len(chunk))
-		buffer.WriteString(chunkLength)
-		buffer.Write(chunk)
+// Announces a trailer field on the Trailer header of a chunked request
+func (r *ClientHTTPRequest) DeclareTrailer(key string) {
+	r.AddHeader("Trailer", strings.TrimSpace(key))
+}
 
-		buffer.WriteString("\r\n")
+// Sets a trailer field sent after the last chunk. Must be called before Done
+func (r *ClientHTTPRequest) SetTrailer(key string, value string) {
+	r.trailers[strings.ToLower(strings.TrimSpace(key))] = []string{strings.TrimSpace(value)}
+}
 
-		connection.Write(buffer.Bytes())
+// Writes the chunks sent with SendChunk until Done is called. Stops when the context is done or a write fails
+func (r ClientHTTPRequest) sendChunks(ctx context.Context, connection net.Conn) error {
+	for {
+		var chunk []byte
+		var open bool
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case chunk, open = <-r.chunkChannel:
+		}
+		if !open {
+			break
+		}
+		if err := writeChunkData(connection, chunk); err != nil {
+			return err
+		}
 	}
 
-	connection.Write([]byte("0 \r\n\r\n"))
+	return writeLastChunk(connection, r.trailers)
+}
+
+// Writes the body set by SetBodyReader, as a chunked body if its length is unknown
+func (r ClientHTTPRequest) writeBodyReader(connection net.Conn) error {
+	if r.bodyLength >= 0 {
+		_, err := io.CopyN(connection, r.bodyReader, r.bodyLength)
+		if err == io.EOF {
+			return errors.New("request body is shorter than its length")
+		}
+		return err
+	}
+
+	var buffer = make([]byte, 32*1024)
+	for {
+		read, err := r.bodyReader.Read(buffer)
+		if read > 0 {
+			if writeErr := writeChunkData(connection, buffer[:read]); writeErr != nil {
+				return writeErr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writeLastChunk(connection, r.trailers)
 }
 
 func (r ClientHTTPRequest) toBytes() ([]byte, error) {
 	buffer := new(bytes.Buffer)
-	var requestLine = fmt.Sprintf("%s %s HTTP/%s\r\n", r.method, r.uri.RequestURI(), r.version)
+	var target = r.uri.RequestURI()
+	if r.forwardProxy {
+		absoluteURI := *r.uri
+		absoluteURI.User = nil
+		absoluteURI.Fragment = ""
+		target = absoluteURI.String()
+	}
+	var requestLine = fmt.Sprintf("%s %s HTTP/%s\r\n", r.method, target, r.version)
 	buffer.WriteString(requestLine)
+	if r.proxyAuthorization != "" {
+		buffer.WriteString("Proxy-Authorization: " + r.proxyAuthorization + "\r\n")
+	}
 
-	if r.chunked {
+	if r.chunked || r.bodyReader != nil && r.bodyLength < 0 {
+		if r.version == "1.0" {
+			return nil, errors.New("chunked body requires HTTP/1.1")
+		}
 		r.SetHeader("Transfer-Encoding", "chunked")
+		delete(r.headers, "content-length")
+	} else if r.bodyReader != nil {
+		if r.method == MethodGet || r.method == MethodHead {
+			return nil, fmt.Errorf("method %s should not have a body", r.method)
+		}
+		r.SetHeader("Content-Length", strconv.FormatInt(r.bodyLength, 10))
+		delete(r.headers, "transfer-encoding")
 	} else if len(r.body) > 0 {
 		r.SetHeader("Content-Length", strconv.Itoa(len(r.body)))
+		delete(r.headers, "transfer-encoding")
 	}
 
 	for headerName, headerValue := range r.headers {
@@ -155,7 +274,7 @@ func (r ClientHTTPRequest) toBytes() ([]byte, error) {
 		for i, cookie := range r.cookies {
 			cookieBuilder.WriteString(cookie.Name)
 			cookieBuilder.WriteString("=")
-			cookieBuilder.WriteString(cookie.Value)
+			cookieBuilder.WriteString(sanitizeCookieValue(cookie.Value))
 			if i < len(r.cookies)-1 {
 				cookieBuilder.WriteString("; ")
 			}
@@ -195,6 +314,7 @@ func NewRequestWithBody(uri string, body []byte) (ClientHTTPRequest, error) {
 		chunked:      false,
 		uri:          requestURI,
 		cookies:      make([]*Cookie, 0, 5),
+		trailers:     make(Headers),
 	}
 
 	if len(body) > 0 {
@@ -220,6 +340,7 @@ func NewRequest(uri string) (ClientHTTPRequest, error) {
 		chunked:      false,
 		uri:          requestURI,
 		cookies:      make([]*Cookie, 0, 5),
+		trailers:     make(Headers),
 	}
 
 	newRequest.SetHeader("User-Agent", softwareName)
@@ -1,8 +1,8 @@
 package easyhttp
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"log"
@@ -19,22 +19,45 @@ type ClientHTTPResponse struct {
 	StatusCode int
 	body       *bytes.Buffer
 	version    string
+	trailers   Headers
+	// Extensions of the last chunk received
+	chunkExtensions map[string]string
+	// Set when the whole body was read from the connection
+	bodyComplete bool
+	// Body read from the connection, set when the request asked to stream the response
+	stream *clientResponseBody
 }
 
 func (r *ClientHTTPResponse) HasBody() bool {
-	return r.body != nil && r.body.Len() > 0
+	return r.stream != nil || r.body != nil && r.body.Len() > 0
 }
 
 func (r *ClientHTTPResponse) GetBody() io.Reader {
+	if r.stream != nil {
+		return r.stream
+	}
 	return r.body
 }
 
+// Returns the response body. Bodies are read into memory before the request returns unless the request called StreamResponse,
+// since callers of GetBody and of the chunk functions expect a complete body and a buffered body never holds a pooled connection.
+// Streamed bodies read from the connection and must be read to the end or closed to release it, while closing a body that was already read is a no-op
+func (r *ClientHTTPResponse) Body() io.ReadCloser {
+	if r.stream != nil {
+		return r.stream
+	}
+	return io.NopCloser(r)
+}
+
 func (r *ClientHTTPResponse) Version() string {
 	return r.version
 }
 
 func (r *ClientHTTPResponse) Read(buffer []byte) (int, error) {
-	if r.body.Len() == 0 {
+	if r.stream != nil {
+		return r.stream.Read(buffer)
+	}
+	if r.body == nil || r.body.Len() == 0 {
 		return 0, io.EOF
 	}
 	return r.body.Read(buffer)
@@ -80,6 +103,16 @@ func (r *ClientHTTPResponse) Headers() Headers {
 	return r.headers
 }
 
+// Returns the trailer fields received after the last chunk of a chunked response
+func (r *ClientHTTPResponse) Trailers() Headers {
+	return r.trailers
+}
+
+// Returns the extensions of the last chunk received. Useful inside an onChunk function
+func (r *ClientHTTPResponse) ChunkExtensions() map[string]string {
+	return r.chunkExtensions
+}
+
 func (r *ClientHTTPResponse) Cookies() []*Cookie {
 	var cookies = make([]*Cookie, 0, 5)
 	cookieHeader := r.GetHeader("Set-Cookie")
@@ -94,18 +127,30 @@ func (r *ClientHTTPResponse) Cookies() []*Cookie {
 	return cookies
 }
 
-func parseResponse(connection net.Conn, request ClientHTTPRequest) (*ClientHTTPResponse, error) {
-	var responseReader = textproto.NewReader(bufio.NewReader(connection))
-	response, err := parseResponsefromConnection(responseReader)
-	if err != nil {
-		return nil, err
+// Read deadlines applied while a client reads a response
+type responseDeadlines struct {
+	// Aborts the read when done. Ignored if nil
+	ctx context.Context
+	// Renewed before every read. Disabled if zero
+	idleTimeout time.Duration
+	// Limit for the whole read. None if zero
+	deadline time.Time
+}
+
+// Sets the read deadline of the connection. A done context sets a deadline in the past,
+// so a cancellation that happened while the deadline was being renewed is not lost
+func (d responseDeadlines) apply(connection net.Conn) {
+	var readDeadline = d.deadline
+	if d.idleTimeout > 0 {
+		idleDeadline := time.Now().Add(d.idleTimeout)
+		if readDeadline.IsZero() || idleDeadline.Before(readDeadline) {
+			readDeadline = idleDeadline
+		}
 	}
-
-	err = parseResponseBody(response, connection, responseReader, request.onResponseChunk)
-	if err != nil {
-		return nil, err
+	connection.SetReadDeadline(readDeadline)
+	if d.ctx != nil && d.ctx.Err() != nil {
+		connection.SetDeadline(time.Unix(1, 0))
 	}
-	return response, nil
 }
 
 func parseResponseStatusLine(statusLine string, response *ClientHTTPResponse) error {
@@ -142,7 +187,7 @@ func parseResponseHeaders(responseReader *textproto.Reader, response *ClientHTTP
 		}
 		headerSplit := strings.Split(line, ":")
 		if len(headerSplit) >= 2 {
-			for _, value := range strings.Split(strings.Join(headerSplit[1:], ":"), ",") {
+			for _, value := range splitHeaderValues(headerSplit[0], strings.Join(headerSplit[1:], ":")) {
 				response.AddHeader(headerSplit[0], strings.TrimSpace(value))
 			}
 		}
@@ -170,12 +215,13 @@ func parseResponsefromConnection(responseReader *textproto.Reader) (*ClientHTTPR
 	return response, nil
 }
 
-func parseResponseBody(response *ClientHTTPResponse, connection net.Conn, responseReader *textproto.Reader, onResponseChunk ClientChunkFunction) error {
+// Reads the response body, applying the deadlines before every read
+func parseResponseBody(response *ClientHTTPResponse, connection net.Conn, responseReader *textproto.Reader, onResponseChunk ClientChunkFunction, deadlines responseDeadlines) error {
 	contentLengthHeader := response.GetHeader("Content-Length")
 	var err error
-	connection.SetReadDeadline(time.Now().Add(KEEP_ALIVE_TIMEOUT * time.Second))
+	deadlines.apply(connection)
 	if response.version == "1.1" && response.HasHeaderValue("Transfer-Encoding", "chunked") {
-		response.body, err = parseClientChunkedBody(responseReader, connection, response, onResponseChunk)
+		response.body, err = parseClientChunkedBody(responseReader, connection, response, onResponseChunk, deadlines)
 		if err != nil {
 			return err
 		}
@@ -192,8 +238,11 @@ func parseResponseBody(response *ClientHTTPResponse, connection net.Conn, respon
 			}
 			response.body = bytes.NewBuffer(responseBody)
 		}
+		response.bodyComplete = true
 	} else {
 		response.body = nil
+		// Without a length the body ends when the server closes the connection
+		response.bodyComplete = response.StatusCode < 200 || response.StatusCode == STATUS_NO_CONTENT || response.StatusCode == STATUS_NOT_MODIFIED
 	}
 	return nil
 }
@@ -0,0 +1,197 @@
+package easyhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Default number of attempts of a request, including the first one
+const DEFAULT_RETRY_ATTEMPTS = 3
+
+// Default delay before the first retry, doubled on every retry
+const DEFAULT_RETRY_BASE_DELAY = 100 * time.Millisecond
+
+// Default maximum delay between attempts
+const DEFAULT_RETRY_MAX_DELAY = 10 * time.Second
+
+// Statuses retried by default
+var defaultRetryStatuses = []int{STATUS_TOO_MANY_REQUESTS, STATUS_BAD_GATEWAY, STATUS_SERVICE_UNAVAILABLE, STATUS_GATEWAY_TIMEOUT}
+
+// Policy used by the client to retry requests that failed with a connection error or a retryable status.
+// Only idempotent methods and requests with an Idempotency-Key header are retried, and only if their body can be sent again
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one
+	MaxAttempts int
+	// Delay before the first retry. Each retry doubles it and a random jitter picks a delay between zero and the result
+	BaseDelay time.Duration
+	// Maximum delay between attempts. A Retry-After longer than it stops the retries
+	MaxDelay time.Duration
+	// Statuses that are retried
+	RetryStatuses []int
+}
+
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:   DEFAULT_RETRY_ATTEMPTS,
+		BaseDelay:     DEFAULT_RETRY_BASE_DELAY,
+		MaxDelay:      DEFAULT_RETRY_MAX_DELAY,
+		RetryStatuses: slices.Clone(defaultRetryStatuses),
+	}
+}
+
+// Error of a reused connection that failed before the server sent anything, which usually means the server closed it
+type staleConnectionError struct {
+	err error
+}
+
+func (e *staleConnectionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *staleConnectionError) Unwrap() error {
+	return e.err
+}
+
+// Checks if a reused connection failed before any byte of the response was read
+func isStaleConnection(ctx context.Context, connection *pooledConnection, bytesReadBefore int64, err error) bool {
+	if !connection.reused || connection.bytesRead != bytesReadBefore || ctx.Err() != nil {
+		return false
+	}
+	return isConnectionFailure(err)
+}
+
+// Checks if the error means the connection was lost, as opposed to a timeout or an invalid response
+func isConnectionFailure(err error) bool {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return false
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, net.ErrClosed)
+}
+
+func isIdempotentRequest(request *ClientHTTPRequest) bool {
+	switch request.method {
+	case MethodGet, MethodHead, MethodOptions, MethodTrace, MethodPut, MethodDelete:
+		return true
+	}
+	return request.GetHeader("Idempotency-Key") != nil
+}
+
+// Checks if the body of the request can be sent again
+func (r *ClientHTTPRequest) replayableBody() bool {
+	if r.chunked {
+		return false
+	}
+	if r.bodyReader != nil {
+		_, seekable := r.bodyReader.(io.Seeker)
+		return seekable
+	}
+	return true
+}
+
+// Moves a seekable body reader back to where it started
+func (r *ClientHTTPRequest) rewindBody() error {
+	if seeker, ok := r.bodyReader.(io.Seeker); ok {
+		_, err := seeker.Seek(r.bodyStart, io.SeekStart)
+		return err
+	}
+	return nil
+}
+
+// Sends the request, retrying it on a fresh connection once if a pooled connection turned out to be closed
+// and then as the retry policy of the client allows
+func (c *httpClient) roundTripWithRetries(ctx context.Context, request *ClientHTTPRequest) (*ClientHTTPResponse, error) {
+	var retriedStale = false
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 || retriedStale {
+			if err := request.rewindBody(); err != nil {
+				return nil, err
+			}
+		}
+		response, err := c.roundTripWithBreaker(ctx, request, retriedStale)
+		var staleErr *staleConnectionError
+		if errors.As(err, &staleErr) {
+			if !retriedStale && request.replayableBody() {
+				retriedStale = true
+				attempt--
+				continue
+			}
+			err = staleErr.err
+		}
+
+		delay, retry := c.Retry.retryDelay(request, response, err, attempt)
+		if !retry {
+			return response, err
+		}
+		if response != nil {
+			response.Body().Close()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Returns the delay before the next attempt and false if the request should not be retried
+func (p *RetryPolicy) retryDelay(request *ClientHTTPRequest, response *ClientHTTPResponse, err error, attempt int) (time.Duration, bool) {
+	if p == nil || attempt >= p.MaxAttempts || !isIdempotentRequest(request) || !request.replayableBody() {
+		return 0, false
+	}
+	if err != nil {
+		if !isConnectionFailure(err) && !errors.Is(err, ErrClientTimeout) {
+			return 0, false
+		}
+		return p.backoff(attempt), true
+	}
+	if !slices.Contains(p.RetryStatuses, response.StatusCode) {
+		return 0, false
+	}
+	if response.StatusCode == STATUS_TOO_MANY_REQUESTS || response.StatusCode == STATUS_SERVICE_UNAVAILABLE {
+		if retryAfter, found := parseRetryAfter(response); found {
+			if p.MaxDelay > 0 && retryAfter > p.MaxDelay {
+				return 0, false
+			}
+			return retryAfter, true
+		}
+	}
+	return p.backoff(attempt), true
+}
+
+// Exponential backoff with full jitter
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	var ceiling = p.BaseDelay << (attempt - 1)
+	if ceiling <= 0 || p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// Parses the Retry-After header, given in seconds or as a HTTP date
+func parseRetryAfter(response *ClientHTTPResponse) (time.Duration, bool) {
+	retryAfterHeader := response.GetHeader("Retry-After")
+	if retryAfterHeader == nil {
+		return 0, false
+	}
+	value := joinHeaderValues(retryAfterHeader)
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := parseHTTPDate(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,257 @@
+package easyhttp
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Options used by the Compression middleware
+type CompressionOptions struct {
+	// Minimum body size in bytes for a buffered response to be compressed
+	MinSize int
+	// Compression level passed to the gzip and deflate writers
+	Level int
+	// Content types that are never compressed. Entries ending in "/" match every subtype
+	SkipContentTypes []string
+}
+
+// Returns the compression options used by default
+func DefaultCompressionOptions() CompressionOptions {
+	return CompressionOptions{
+		MinSize: 1024,
+		Level:   gzip.DefaultCompression,
+		SkipContentTypes: []string{
+			"image/", "video/", "audio/", "font/woff", "font/woff2",
+			"application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2",
+			"application/x-xz", "application/x-7z-compressed", "application/vnd.rar",
+			"application/java-archive", "application/epub+zip", "application/pdf",
+		},
+	}
+}
+
+// Middleware that compresses responses with gzip or deflate when the client accepts it
+func Compression(options CompressionOptions) Middleware {
+	return func(next ResponseFunction) ResponseFunction {
+		return func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+			response.compression = &responseCompression{
+				encoding: negotiateEncoding(request.GetHeader("Accept-Encoding")),
+				options:  options,
+			}
+			next(request, response)
+		}
+	}
+}
+
+type responseCompression struct {
+	encoding string
+	options  CompressionOptions
+}
+
+type compressionWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// Compressor used to compress a chunked response one chunk at a time
+type chunkCompressor struct {
+	buffer *bytes.Buffer
+	writer compressionWriter
+}
+
+func (c *chunkCompressor) compress(chunk []byte) ([]byte, error) {
+	c.buffer.Reset()
+	if _, err := c.writer.Write(chunk); err != nil {
+		return nil, err
+	}
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+	return c.buffer.Bytes(), nil
+}
+
+func (c *chunkCompressor) close() ([]byte, error) {
+	c.buffer.Reset()
+	if err := c.writer.Close(); err != nil {
+		return nil, err
+	}
+	return c.buffer.Bytes(), nil
+}
+
+func newCompressionWriter(encoding string, level int, writer io.Writer) (compressionWriter, error) {
+	if encoding == "deflate" {
+		return zlib.NewWriterLevel(writer, level)
+	}
+	return gzip.NewWriterLevel(writer, level)
+}
+
+// Chooses the preferred supported content coding from the Accept-Encoding values. Returns an empty string if none is acceptable
+func negotiateEncoding(acceptEncoding []string) string {
+	var qualities = make(map[string]float64)
+	for _, value := range acceptEncoding {
+		coding, parameters, _ := strings.Cut(value, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+		var quality = 1.0
+		for _, parameter := range strings.Split(parameters, ";") {
+			name, parameterValue, found := strings.Cut(strings.TrimSpace(parameter), "=")
+			if found && strings.ToLower(strings.TrimSpace(name)) == "q" {
+				parsedQuality, err := strconv.ParseFloat(strings.TrimSpace(parameterValue), 64)
+				if err == nil {
+					quality = parsedQuality
+				}
+			}
+		}
+		qualities[coding] = quality
+	}
+
+	var selectedEncoding = ""
+	var selectedQuality = 0.0
+	for _, encoding := range []string{"gzip", "deflate"} {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > selectedQuality {
+			selectedEncoding = encoding
+			selectedQuality = quality
+		}
+	}
+	return selectedEncoding
+}
+
+func (c *responseCompression) isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+	for _, skipped := range c.options.SkipContentTypes {
+		skipped = strings.ToLower(skipped)
+		if mediaType == skipped || (strings.HasSuffix(skipped, "/") && strings.HasPrefix(mediaType, skipped)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks if the response can be compressed and adds the Vary header when its representation depends on Accept-Encoding
+func (r *ServerHTTPResponse) shouldCompress() bool {
+	if r.compression == nil || r.ExistsHeader("Content-Encoding") || r.ExistsHeader("Content-Range") {
+		return false
+	}
+	if r.statusCode < 200 || r.statusCode == STATUS_NO_CONTENT || r.statusCode == STATUS_PARTIAL_CONTENT || r.statusCode == STATUS_NOT_MODIFIED {
+		return false
+	}
+	var contentType = "text/plain"
+	if contentTypeHeader := r.GetHeader("Content-Type"); contentTypeHeader != nil {
+		contentType = joinHeaderValues(contentTypeHeader)
+	}
+	if !r.compression.isCompressible(contentType) {
+		return false
+	}
+	if !r.HasHeaderValue("Vary", "Accept-Encoding") {
+		r.AddHeader("Vary", "Accept-Encoding")
+	}
+	return r.compression.encoding != ""
+}
+
+func (r *ServerHTTPResponse) setCompressionHeaders() {
+	r.SetHeader("Content-Encoding", r.compression.encoding)
+	delete(r.headers, "content-length")
+	if etag := r.GetHeader("ETag"); etag != nil && !strings.HasPrefix(etag[0], "W/") {
+		r.SetHeader("ETag", "W/"+etag[0])
+	}
+}
+
+// Checks if a buffered response body should be compressed
+func (r *ServerHTTPResponse) shouldCompressBody() bool {
+	return r.body != nil && r.shouldCompress() && r.body.Len() >= r.compression.options.MinSize
+}
+
+// Compresses a buffered response body if compression is enabled for the response
+func (r *ServerHTTPResponse) compressBody() error {
+	if !r.shouldCompressBody() {
+		return nil
+	}
+	compressedBody := new(bytes.Buffer)
+	writer, err := newCompressionWriter(r.compression.encoding, r.compression.options.Level, compressedBody)
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(r.body.Bytes()); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	r.body = compressedBody
+	r.setCompressionHeaders()
+	return nil
+}
+
+// Starts compressing a chunked response if compression is enabled for the response
+func (r *ServerHTTPResponse) startChunkCompression() error {
+	if !r.shouldCompress() {
+		return nil
+	}
+	compressor := &chunkCompressor{buffer: new(bytes.Buffer)}
+	writer, err := newCompressionWriter(r.compression.encoding, r.compression.options.Level, compressor.buffer)
+	if err != nil {
+		return err
+	}
+	compressor.writer = writer
+	r.compressor = compressor
+	r.setCompressionHeaders()
+	return nil
+}
+
+// Decompresses a request body according to its Content-Encoding header.
+// Returns ErrUnsupportedMediaType for unknown codings and ErrContentTooLarge if the decompressed body is bigger than maxSize
+func decompressRequestBody(request *ServerHTTPRequest, maxSize int64) error {
+	encodings := request.GetHeader("Content-Encoding")
+	if encodings == nil || len(request.Body) == 0 {
+		return nil
+	}
+
+	var body = request.Body
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var reader io.Reader
+		var err error
+		switch strings.ToLower(strings.TrimSpace(encodings[i])) {
+		case "identity":
+			continue
+		case "gzip", "x-gzip":
+			reader, err = gzip.NewReader(bytes.NewReader(body))
+		case "deflate":
+			reader, err = zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				reader, err = flate.NewReader(bytes.NewReader(body)), nil
+			}
+		default:
+			return ErrUnsupportedMediaType
+		}
+		if err != nil {
+			return ErrBadRequest
+		}
+		decompressedBody, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+		if err != nil {
+			return ErrBadRequest
+		}
+		if int64(len(decompressedBody)) > maxSize {
+			return ErrContentTooLarge
+		}
+		body = decompressedBody
+	}
+
+	request.Body = body
+	delete(request.headers, "content-encoding")
+	request.SetHeader("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
@@ -0,0 +1,172 @@
+package easyhttp
+
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
+// Sets the ETag header of the response. The tag is quoted if needed and marked as weak if weak is true
+func (r *ServerHTTPResponse) SetETag(etag string, weak bool) {
+	etag = quoteETag(etag)
+	if weak && !strings.HasPrefix(etag, "W/") {
+		etag = "W/" + etag
+	}
+	r.SetHeader("ETag", etag)
+}
+
+// Quotes an entity tag unless it already starts as a strong or weak quoted tag
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, "\"") || strings.HasPrefix(etag, "W/\"") {
+		return etag
+	}
+	return "\"" + etag + "\""
+}
+
+// Sets the Last-Modified header of the response
+func (r *ServerHTTPResponse) SetLastModified(modified time.Time) {
+	r.SetHeader("Last-Modified", modified.UTC().Format(HTTP_TIME_FORMAT))
+}
+
+// Evaluates the request preconditions against the ETag and Last-Modified headers already set on the response.
+// Returns true if the response was turned into a 304 Not Modified or 412 Precondition Failed, in which case the handler can stop.
+// The server only evaluates preconditions automatically after GET and HEAD handlers, so handlers of unsafe methods
+// must call this before changing the resource, or be wrapped with the Preconditions middleware
+func (r *ServerHTTPResponse) EvaluatePreconditions() bool {
+	if r.request == nil {
+		return false
+	}
+	return evaluatePreconditions(r.request, r)
+}
+
+// Function that returns the current ETag and Last-Modified time of the resource targeted by a request.
+// An empty etag or a zero time means the resource has no such validator
+type ValidatorFunction func(ServerHTTPRequest) (string, time.Time)
+
+// Middleware that evaluates the request preconditions before the handler runs, using the validators of the current resource.
+// Requests that fail them get a 304 Not Modified or 412 Precondition Failed and the handler is not run
+func Preconditions(validators ValidatorFunction) Middleware {
+	return func(next ResponseFunction) ResponseFunction {
+		return func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+			etag, lastModified := validators(request)
+			if etag != "" {
+				etag = quoteETag(etag)
+			}
+			status := preconditionStatus(&request, etag, lastModified)
+			if status == 0 {
+				next(request, response)
+				return
+			}
+			if etag != "" {
+				response.SetHeader("ETag", etag)
+			}
+			if !lastModified.IsZero() {
+				response.SetLastModified(lastModified)
+			}
+			setPreconditionStatus(response, status)
+		}
+	}
+}
+
+// Splits a list of entity tags, keeping commas inside quoted tags
+func parseETagList(value string) []string {
+	var etags []string
+	for _, etag := range splitOutsideQuotes(value, ',') {
+		if etag = strings.TrimSpace(etag); etag != "" {
+			etags = append(etags, etag)
+		}
+	}
+	return etags
+}
+
+func weakETagMatch(first string, second string) bool {
+	return strings.TrimPrefix(first, "W/") == strings.TrimPrefix(second, "W/")
+}
+
+func etagListMatches(list string, etag string, strong bool) bool {
+	for _, candidate := range parseETagList(list) {
+		if candidate == "*" {
+			return true
+		}
+		if etag == "" {
+			continue
+		}
+		if strong && strongETagMatch(candidate, etag) {
+			return true
+		}
+		if !strong && weakETagMatch(candidate, etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluates conditional request headers in the order defined by RFC 9110 section 13.2.2
+func evaluatePreconditions(request *ServerHTTPRequest, response *ServerHTTPResponse) bool {
+	if response.statusCode < 200 || response.statusCode >= 300 || response.chunked {
+		return false
+	}
+
+	var etag string
+	if etagHeader := response.GetHeader("ETag"); etagHeader != nil {
+		etag = joinHeaderValues(etagHeader)
+	}
+	var lastModified time.Time
+	if lastModifiedHeader := response.GetHeader("Last-Modified"); lastModifiedHeader != nil {
+		parsedTime, err := parseHTTPDate(joinHeaderValues(lastModifiedHeader))
+		if err == nil {
+			lastModified = parsedTime
+		}
+	}
+
+	if status := preconditionStatus(request, etag, lastModified); status != 0 {
+		setPreconditionStatus(response, status)
+		return true
+	}
+	return false
+}
+
+// Returns the status a request fails its preconditions with against the given validators, or 0 if they pass.
+// A zero lastModified means the resource has no modification date
+func preconditionStatus(request *ServerHTTPRequest, etag string, lastModified time.Time) int {
+	// HTTP dates only carry whole seconds
+	lastModified = lastModified.Truncate(time.Second)
+	var hasLastModified = !lastModified.IsZero()
+	var isGetOrHead = request.method == MethodGet || request.method == MethodHead
+
+	if request.ExistsHeader("If-Match") {
+		if !etagListMatches(joinHeaderValues(request.GetHeader("If-Match")), etag, true) {
+			return STATUS_PRECONDITION_FAILED
+		}
+	} else if request.ExistsHeader("If-Unmodified-Since") && hasLastModified {
+		unmodifiedSince, err := parseHTTPDate(joinHeaderValues(request.GetHeader("If-Unmodified-Since")))
+		if err == nil && lastModified.After(unmodifiedSince) {
+			return STATUS_PRECONDITION_FAILED
+		}
+	}
+
+	if request.ExistsHeader("If-None-Match") {
+		if etagListMatches(joinHeaderValues(request.GetHeader("If-None-Match")), etag, false) {
+			if isGetOrHead {
+				return STATUS_NOT_MODIFIED
+			}
+			return STATUS_PRECONDITION_FAILED
+		}
+	} else if isGetOrHead && request.ExistsHeader("If-Modified-Since") && hasLastModified {
+		modifiedSince, err := parseHTTPDate(joinHeaderValues(request.GetHeader("If-Modified-Since")))
+		if err == nil && !lastModified.After(modifiedSince) {
+			return STATUS_NOT_MODIFIED
+		}
+	}
+	return 0
+}
+
+func setPreconditionStatus(response *ServerHTTPResponse, status int) {
+	response.SetStatus(status)
+	response.body = new(bytes.Buffer)
+	delete(response.headers, "content-length")
+	delete(response.headers, "accept-ranges")
+	if status == STATUS_PRECONDITION_FAILED {
+		delete(response.headers, "content-type")
+	}
+}
@@ -0,0 +1,162 @@
+package easyhttp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Minimum length of the keys used to sign cookies
+const MIN_SIGNING_KEY_LENGTH = 32
+
+// Length of the expiry at the start of signed and encrypted payloads, in unix seconds where zero never expires
+const cookieExpiryLength = 8
+
+// Sets a cookie whose value is signed with HMAC-SHA256, so the client can read it but not change it.
+// The first key signs and the expiry of the cookie is signed with the value. Keys need MIN_SIGNING_KEY_LENGTH bytes
+func (r *ServerHTTPResponse) SetSignedCookie(cookie *Cookie, keys [][]byte) error {
+	if len(keys) == 0 || len(keys[0]) < MIN_SIGNING_KEY_LENGTH {
+		return errors.New("signing key is too short")
+	}
+	signed := *cookie
+	signed.Value = signCookieValue(keys[0], cookie.Name, cookiePayload(cookie, time.Now()))
+	return r.SetCookie(&signed)
+}
+
+// Returns the value of a cookie set with SetSignedCookie, checking its signature with every key so keys can be rotated.
+// Returns ErrCookieNotFound, ErrCookieTampered or ErrCookieExpired otherwise
+func (r *ServerHTTPRequest) SignedCookie(name string, keys [][]byte) (string, error) {
+	value, found := r.cookies[name]
+	if !found {
+		return "", ErrCookieNotFound
+	}
+	payload, err := verifyCookieValue(keys, name, value)
+	if err != nil {
+		return "", err
+	}
+	return openCookiePayload(payload, time.Now())
+}
+
+// Sets a cookie whose value is encrypted with AES-GCM, so the client can neither read nor change it.
+// The first key encrypts and must have 16, 24 or 32 bytes. The expiry of the cookie is encrypted with the value
+func (r *ServerHTTPResponse) SetEncryptedCookie(cookie *Cookie, keys [][]byte) error {
+	if len(keys) == 0 {
+		return errors.New("no encryption key")
+	}
+	aead, err := newCookieAEAD(keys[0])
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, cookiePayload(cookie, time.Now()), []byte(cookie.Name))
+	encrypted := *cookie
+	encrypted.Value = base64.RawURLEncoding.EncodeToString(sealed)
+	return r.SetCookie(&encrypted)
+}
+
+// Returns the value of a cookie set with SetEncryptedCookie, trying every key so keys can be rotated.
+// Returns ErrCookieNotFound, ErrCookieTampered or ErrCookieExpired otherwise
+func (r *ServerHTTPRequest) EncryptedCookie(name string, keys [][]byte) (string, error) {
+	value, found := r.cookies[name]
+	if !found {
+		return "", ErrCookieNotFound
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", ErrCookieTampered
+	}
+	for _, key := range keys {
+		aead, err := newCookieAEAD(key)
+		if err != nil || len(sealed) < aead.NonceSize() {
+			continue
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if payload, err := aead.Open(nil, nonce, ciphertext, []byte(name)); err == nil {
+			return openCookiePayload(payload, time.Now())
+		}
+	}
+	return "", ErrCookieTampered
+}
+
+func newCookieAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Returns the payload followed by its signature, both encoded as base64url
+func signCookieValue(key []byte, name string, payload []byte) string {
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signCookie(key, name, payload))
+}
+
+// Returns the payload of a value made by signCookieValue if any of the keys signed it
+func verifyCookieValue(keys [][]byte, name string, value string) ([]byte, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(value, ".")
+	if !found {
+		return nil, ErrCookieTampered
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrCookieTampered
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, ErrCookieTampered
+	}
+	for _, key := range keys {
+		if hmac.Equal(signature, signCookie(key, name, payload)) {
+			return payload, nil
+		}
+	}
+	return nil, ErrCookieTampered
+}
+
+// The name is signed too, so a value cannot be moved to another cookie signed with the same key
+func signCookie(key []byte, name string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// Returns the expiry of the cookie followed by its value. Max-Age takes precedence over Expires
+func cookiePayload(cookie *Cookie, now time.Time) []byte {
+	var expiry int64
+	if cookie.MaxAge != 0 {
+		expiry = now.Add(time.Duration(cookie.MaxAge) * time.Second).Unix()
+	} else if !cookie.Expires.IsZero() {
+		expiry = cookie.Expires.Unix()
+	}
+	return expiringPayload(expiry, []byte(cookie.Value))
+}
+
+func expiringPayload(expiry int64, value []byte) []byte {
+	payload := make([]byte, cookieExpiryLength, cookieExpiryLength+len(value))
+	binary.BigEndian.PutUint64(payload, uint64(expiry))
+	return append(payload, value...)
+}
+
+func openCookiePayload(payload []byte, now time.Time) (string, error) {
+	if len(payload) < cookieExpiryLength {
+		return "", ErrCookieTampered
+	}
+	expiry := int64(binary.BigEndian.Uint64(payload))
+	if expiry != 0 && now.Unix() >= expiry {
+		return "", ErrCookieExpired
+	}
+	return string(payload[cookieExpiryLength:]), nil
+}
@@ -0,0 +1,321 @@
+package easyhttp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stores the cookies received by the client and returns the cookies it sends
+type CookieJar interface {
+	// Stores the cookies received from the url
+	SetCookies(url *url.URL, cookies []*Cookie)
+	// Returns the cookies sent to the url
+	Cookies(url *url.URL) []*Cookie
+}
+
+// Implemented by jars that leave out SameSite cookies on cross site requests
+type siteAwareCookieJar interface {
+	cookiesFor(url *url.URL, initiator *url.URL, method string) []*Cookie
+}
+
+func (c *httpClient) jarCookies(uri *url.URL, initiator *url.URL, method string) []*Cookie {
+	if c.CookieJar == nil {
+		return nil
+	}
+	if jar, ok := c.CookieJar.(siteAwareCookieJar); ok {
+		return jar.cookiesFor(uri, initiator, method)
+	}
+	return c.CookieJar.Cookies(uri)
+}
+
+func (c *httpClient) storeCookies(uri *url.URL, cookies []*Cookie) {
+	if c.CookieJar != nil && len(cookies) > 0 {
+		c.CookieJar.SetCookies(uri, cookies)
+	}
+}
+
+// Format of the file of a PersistentCookieJar
+type CookieFileFormat int
+
+const (
+	// JSON array keeping every attribute of the cookies
+	COOKIE_FILE_JSON CookieFileFormat = iota
+	// Netscape cookies.txt format read by curl, wget and browsers extensions. SameSite and creation times are not kept
+	COOKIE_FILE_NETSCAPE
+)
+
+// Cookie jar that keeps persistent cookies in a file between runs. Session cookies are kept in memory only
+type PersistentCookieJar struct {
+	*CookieStorage
+	// Called with the error when saving the file from SetCookies fails. Errors are ignored if nil
+	OnSaveError func(error)
+
+	path   string
+	format CookieFileFormat
+	// Serializes writes to the file
+	fileMutex sync.Mutex
+}
+
+// Creates a jar backed by the file at path, loading its cookies if it exists. Expired cookies are dropped
+func NewPersistentCookieJar(path string, format CookieFileFormat) (*PersistentCookieJar, error) {
+	if format != COOKIE_FILE_JSON && format != COOKIE_FILE_NETSCAPE {
+		return nil, errors.New("unknown cookie file format")
+	}
+	jar := &PersistentCookieJar{
+		CookieStorage: NewCookieStorage(),
+		path:          path,
+		format:        format,
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return jar, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []cookieEntry
+	if format == COOKIE_FILE_JSON {
+		entries, err = readJSONCookies(file)
+	} else {
+		entries, err = readNetscapeCookies(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading cookie file: %w", err)
+	}
+	jar.load(entries, time.Now())
+	return jar, nil
+}
+
+// Stores the cookies and saves the file if a persistent cookie was added, replaced or removed. Errors saving are passed to OnSaveError
+func (j *PersistentCookieJar) SetCookies(url *url.URL, cookies []*Cookie) {
+	if !j.CookieStorage.setCookies(url, cookies) {
+		return
+	}
+	if err := j.Save(); err != nil && j.OnSaveError != nil {
+		j.OnSaveError(err)
+	}
+}
+
+// Writes the persistent cookies that did not expire to the file. The file is replaced atomically, so it is never left half written
+func (j *PersistentCookieJar) Save() error {
+	j.fileMutex.Lock()
+	defer j.fileMutex.Unlock()
+	entries := j.entries(time.Now())
+
+	temporary, err := os.CreateTemp(filepath.Dir(j.path), "."+filepath.Base(j.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+
+	writer := bufio.NewWriter(temporary)
+	if j.format == COOKIE_FILE_JSON {
+		err = writeJSONCookies(writer, entries)
+	} else {
+		err = writeNetscapeCookies(writer, entries)
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = temporary.Sync()
+	}
+	if closeErr := temporary.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), j.path)
+}
+
+// Stored cookie as written to a cookie file
+type cookieEntry struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	HostOnly bool      `json:"host_only"`
+	Secure   bool      `json:"secure"`
+	HTTPOnly bool      `json:"http_only"`
+	SameSite SameSite  `json:"same_site"`
+	Expires  time.Time `json:"expires"`
+	Creation time.Time `json:"creation"`
+}
+
+// Returns the persistent cookies that did not expire, oldest first
+func (cs *CookieStorage) entries(now time.Time) []cookieEntry {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	var entries []cookieEntry
+	for _, domainCookies := range cs.cookieMap {
+		for _, stored := range domainCookies {
+			if !stored.persistent || !stored.expires.After(now) {
+				continue
+			}
+			entries = append(entries, cookieEntry{
+				Name:     stored.cookie.Name,
+				Value:    stored.cookie.Value,
+				Domain:   stored.cookie.Domain,
+				Path:     stored.cookie.Path,
+				HostOnly: stored.hostOnly,
+				Secure:   stored.cookie.Secure,
+				HTTPOnly: stored.cookie.HTTPOnly,
+				SameSite: stored.cookie.SameSite,
+				Expires:  stored.expires.UTC(),
+				Creation: stored.creation.UTC(),
+			})
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b cookieEntry) int {
+		return a.Creation.Compare(b.Creation)
+	})
+	return entries
+}
+
+// Stores cookies read from a file as they were, without checking them against a request url
+func (cs *CookieStorage) load(entries []cookieEntry, now time.Time) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	for _, entry := range entries {
+		var domain = canonicalHost(strings.TrimPrefix(entry.Domain, "."))
+		if entry.Name == "" || domain == "" || !entry.Expires.After(now) {
+			continue
+		}
+		var path = entry.Path
+		if path == "" || path[0] != '/' {
+			path = "/"
+		}
+		var creation = entry.Creation
+		if creation.IsZero() {
+			creation = now
+		}
+		domainCookies, found := cs.cookieMap[domain]
+		if !found {
+			domainCookies = make(map[cookieKey]*storedCookie)
+			cs.cookieMap[domain] = domainCookies
+		}
+		cs.accessCounter++
+		cs.creationCounter++
+		domainCookies[cookieKey{name: entry.Name, path: path}] = &storedCookie{
+			cookie: Cookie{
+				Name:     entry.Name,
+				Value:    entry.Value,
+				Expires:  entry.Expires,
+				Domain:   domain,
+				Path:     path,
+				Secure:   entry.Secure,
+				HTTPOnly: entry.HTTPOnly,
+				SameSite: entry.SameSite,
+			},
+			hostOnly:   entry.HostOnly,
+			persistent: true,
+			expires:    entry.Expires,
+			creation:   creation,
+			sequence:   cs.creationCounter,
+			lastAccess: cs.accessCounter,
+		}
+		cs.evict(domain, now)
+	}
+}
+
+func readJSONCookies(reader io.Reader) ([]cookieEntry, error) {
+	var entries []cookieEntry
+	if err := json.NewDecoder(reader).Decode(&entries); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func writeJSONCookies(writer io.Writer, entries []cookieEntry) error {
+	if entries == nil {
+		entries = []cookieEntry{}
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+const NETSCAPE_HTTP_ONLY_PREFIX = "#HttpOnly_"
+
+// Reads lines of domain, include subdomains, path, secure, expiry in unix seconds, name and value separated by tabs
+func readNetscapeCookies(reader io.Reader) ([]cookieEntry, error) {
+	var entries []cookieEntry
+	scanner := bufio.NewScanner(reader)
+	var lineNumber = 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		var httpOnly bool
+		if after, found := strings.CutPrefix(line, NETSCAPE_HTTP_ONLY_PREFIX); found {
+			line, httpOnly = after, true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d: expected 7 fields, got %d", lineNumber, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad expiry", lineNumber)
+		}
+		if expires == 0 {
+			// Session cookies saved by other programs
+			continue
+		}
+		entries = append(entries, cookieEntry{
+			Domain:   fields[0],
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Expires:  time.Unix(expires, 0).UTC(),
+			Name:     fields[5],
+			Value:    fields[6],
+			HTTPOnly: httpOnly,
+		})
+	}
+	return entries, scanner.Err()
+}
+
+func writeNetscapeCookies(writer io.Writer, entries []cookieEntry) error {
+	if _, err := io.WriteString(writer, "# Netscape HTTP Cookie File\n\n"); err != nil {
+		return err
+	}
+	var flag = func(value bool) string {
+		if value {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	for _, entry := range entries {
+		var domain = entry.Domain
+		if !entry.HostOnly {
+			domain = "." + domain
+		}
+		if entry.HTTPOnly {
+			domain = NETSCAPE_HTTP_ONLY_PREFIX + domain
+		}
+		_, err := fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, flag(!entry.HostOnly), entry.Path,
+			flag(entry.Secure), entry.Expires.Unix(), entry.Name, entry.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,12 +1,15 @@
 package easyhttp
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
-	"maps"
+	"net"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,23 +23,30 @@ type Cookie struct {
 	Secure   bool
 	HTTPOnly bool
 	SameSite SameSite
+	// Attributes this package does not know, like Partitioned or Priority=High, kept as received and written back by String
+	Unparsed []string
 
 	creation time.Time
 }
 
+// Returns the cookie as a Set-Cookie value. Returns an empty string if the name is not valid.
+// Invalid bytes are removed from the value, which is quoted if it has spaces or commas, and invalid attributes are left out
 func (c *Cookie) String() string {
+	if !isToken(c.Name) {
+		return ""
+	}
 	cookieStringBuilder := strings.Builder{}
-	cookieStringBuilder.WriteString(fmt.Sprintf("%s=%s", c.Name, c.Value))
-	if !c.Expires.IsZero() {
-		cookieStringBuilder.WriteString(fmt.Sprintf("; Expires=%s", c.Expires.Format(time.RFC1123)))
+	cookieStringBuilder.WriteString(fmt.Sprintf("%s=%s", c.Name, sanitizeCookieValue(c.Value)))
+	if validCookieExpires(c.Expires) {
+		cookieStringBuilder.WriteString(fmt.Sprintf("; Expires=%s", c.Expires.UTC().Format(HTTP_TIME_FORMAT)))
 	}
 	if c.MaxAge != 0 {
 		cookieStringBuilder.WriteString(fmt.Sprintf("; Max-Age=%d", c.MaxAge))
 	}
-	if c.Domain != "" {
-		cookieStringBuilder.WriteString(fmt.Sprintf("; Domain=%s", c.Domain))
+	if c.Domain != "" && validCookieDomain(c.Domain) {
+		cookieStringBuilder.WriteString(fmt.Sprintf("; Domain=%s", strings.TrimPrefix(c.Domain, ".")))
 	}
-	if c.Path != "" {
+	if c.Path != "" && validCookieAttributeValue(c.Path) {
 		cookieStringBuilder.WriteString(fmt.Sprintf("; Path=%s", c.Path))
 	}
 	if c.Secure {
@@ -54,9 +64,42 @@ func (c *Cookie) String() string {
 	if c.SameSite == SAME_SITE_NONE {
 		cookieStringBuilder.WriteString("; SameSite=None")
 	}
+	for _, attribute := range c.Unparsed {
+		if attribute != "" && validCookieAttributeValue(attribute) {
+			cookieStringBuilder.WriteString("; " + attribute)
+		}
+	}
 	return cookieStringBuilder.String()
 }
 
+// Checks the cookie against the Set-Cookie grammar of RFC 6265 section 4.1. Returns an error wrapping ErrInvalidCookie otherwise
+func (c *Cookie) Valid() error {
+	if !isToken(c.Name) {
+		return fmt.Errorf("%w: name %q", ErrInvalidCookie, c.Name)
+	}
+	if !validCookieValue(c.Value) {
+		return fmt.Errorf("%w: value of %s", ErrInvalidCookie, c.Name)
+	}
+	if !c.Expires.IsZero() && !validCookieExpires(c.Expires) {
+		return fmt.Errorf("%w: expires of %s", ErrInvalidCookie, c.Name)
+	}
+	if c.Domain != "" && !validCookieDomain(c.Domain) {
+		return fmt.Errorf("%w: domain %q", ErrInvalidCookie, c.Domain)
+	}
+	if c.Path != "" && !validCookieAttributeValue(c.Path) {
+		return fmt.Errorf("%w: path %q", ErrInvalidCookie, c.Path)
+	}
+	if c.SameSite == SAME_SITE_NONE && !c.Secure {
+		return fmt.Errorf("%w: SameSite=None requires Secure", ErrInvalidCookie)
+	}
+	for _, attribute := range c.Unparsed {
+		if !validCookieAttributeValue(attribute) {
+			return fmt.Errorf("%w: attribute %q", ErrInvalidCookie, attribute)
+		}
+	}
+	return nil
+}
+
 type SameSite int
 
 const (
@@ -66,104 +109,361 @@ const (
 	SAME_SITE_NONE
 )
 
+const (
+	// Cookies kept for a single domain before the least recently used are evicted
+	DEFAULT_MAX_COOKIES_PER_DOMAIN = 50
+	// Cookies kept in total before the least recently used are evicted
+	DEFAULT_MAX_COOKIES = 3000
+)
+
+// Cookie jar kept in memory, following the storage and retrieval rules of RFC 6265. Safe for concurrent use
 type CookieStorage struct {
-	cookieMap map[string]map[string]*Cookie
+	// Rejects cookies set for a public suffix like Domain=co.uk. The list returned by DefaultPublicSuffixList is used if nil
+	PublicSuffixes PublicSuffixList
+	// DEFAULT_MAX_COOKIES_PER_DOMAIN is used if zero
+	MaxCookiesPerDomain int
+	// DEFAULT_MAX_COOKIES is used if zero
+	MaxCookies int
+
+	mutex     sync.Mutex
+	cookieMap map[string]map[cookieKey]*storedCookie
+	// Increases on every access so the least recently used cookie can be found even within the clock resolution
+	accessCounter   uint64
+	creationCounter uint64
+}
+
+type cookieKey struct {
+	name string
+	path string
+}
+
+type storedCookie struct {
+	cookie     Cookie
+	hostOnly   bool
+	persistent bool
+	expires    time.Time
+	creation   time.Time
+	// Orders cookies created within the clock resolution, like the ones of a single response
+	sequence   uint64
+	lastAccess uint64
 }
 
-func newCookieStorage() *CookieStorage {
+func NewCookieStorage() *CookieStorage {
 	return &CookieStorage{
-		cookieMap: make(map[string]map[string]*Cookie),
+		cookieMap: make(map[string]map[cookieKey]*storedCookie),
 	}
 }
 
+// Stores the cookies received from the url. Cookies with a domain that does not match the url or that is a public suffix are ignored.
+// A negative MaxAge or an Expires in the past removes the stored cookie. A positive MaxAge takes precedence over Expires
 func (cs *CookieStorage) SetCookies(url *url.URL, cookies []*Cookie) {
+	cs.setCookies(url, cookies)
+}
+
+// Stores the cookies, returning true if a persistent cookie was added, replaced or removed
+func (cs *CookieStorage) setCookies(url *url.URL, cookies []*Cookie) bool {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	var persistentChanged = false
+	var now = time.Now()
+	var host = canonicalHost(url.Hostname())
 	for _, c := range cookies {
-		var host string = url.Hostname()
-		if c.Domain != "" {
-			host = c.Domain
+		domain, hostOnly, ok := cs.cookieDomain(host, c.Domain)
+		if !ok {
+			continue
+		}
+		if c.SameSite == SAME_SITE_NONE && !c.Secure {
+			continue
+		}
+
+		var stored = &storedCookie{
+			cookie:   *c,
+			hostOnly: hostOnly,
+			creation: now,
+		}
+		cs.creationCounter++
+		stored.sequence = cs.creationCounter
+		stored.cookie.Domain = domain
+		if stored.cookie.Path == "" || stored.cookie.Path[0] != '/' {
+			stored.cookie.Path = defaultCookiePath(url.Path)
+		}
+		if c.MaxAge < 0 {
+			stored.persistent, stored.expires = true, now
+		} else if c.MaxAge > 0 {
+			stored.persistent, stored.expires = true, now.Add(time.Duration(c.MaxAge)*time.Second)
+		} else if !c.Expires.IsZero() {
+			stored.persistent, stored.expires = true, c.Expires
+		}
+
+		var key = cookieKey{name: c.Name, path: stored.cookie.Path}
+		domainCookies, found := cs.cookieMap[domain]
+		if !found {
+			domainCookies = make(map[cookieKey]*storedCookie)
+			cs.cookieMap[domain] = domainCookies
 		}
-		if _, ok := cs.cookieMap[host]; !ok {
-			cs.cookieMap[host] = make(map[string]*Cookie)
+		if old, found := domainCookies[key]; found {
+			stored.creation = old.creation
+			stored.sequence = old.sequence
+			delete(domainCookies, key)
+			persistentChanged = persistentChanged || old.persistent
 		}
-		if !c.Expires.IsZero() && c.Expires.Before(time.Now().UTC()) {
-			delete(cs.cookieMap[host], c.Name)
-		} else {
-			cs.cookieMap[host][c.Name] = c
+		if stored.persistent && !stored.expires.After(now) {
+			continue
+		}
+		cs.accessCounter++
+		stored.lastAccess = cs.accessCounter
+		domainCookies[key] = stored
+		persistentChanged = persistentChanged || stored.persistent
+		if cs.evict(domain, now) {
+			persistentChanged = true
 		}
 	}
+	return persistentChanged
 }
 
+// Returns the cookies sent to the url, longer paths first and then older cookies first
 func (cs *CookieStorage) Cookies(url *url.URL) []*Cookie {
-	var host = url.Hostname()
-	var cookies []*Cookie
-
-	if _, ok := cs.cookieMap[host]; ok {
-		cookieIterator := maps.Values(cs.cookieMap[host])
-		for cookie := range cookieIterator {
-			if !cookie.Expires.IsZero() && cookie.Expires.Before(time.Now().UTC()) {
-				delete(cs.cookieMap[host], cookie.Name)
+	return cs.cookiesFor(url, nil, MethodGet)
+}
+
+// Returns the cookies sent to the url on a request started by the site of initiator, which is the same site if nil.
+// Cross site requests leave out SameSite=Strict cookies and SameSite=Lax cookies unless the method is safe
+func (cs *CookieStorage) cookiesFor(url *url.URL, initiator *url.URL, method string) []*Cookie {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	var now = time.Now()
+	var host = canonicalHost(url.Hostname())
+	var secure = url.Scheme == "https" || url.Scheme == "wss"
+	var crossSite = initiator != nil && !cs.isSameSite(url, initiator)
+	var requestPath = url.Path
+	if requestPath == "" {
+		requestPath = "/"
+	}
+
+	var matches []*storedCookie
+	for domain, domainCookies := range cs.cookieMap {
+		if !domainMatches(host, domain) {
+			continue
+		}
+		for key, stored := range domainCookies {
+			if stored.persistent && !stored.expires.After(now) {
+				delete(domainCookies, key)
 				continue
 			}
-			if cookie.Secure && url.Scheme != "https" {
+			if stored.hostOnly && host != domain || !pathMatches(requestPath, stored.cookie.Path) {
 				continue
 			}
-			if matchesPath(url.Path, cookie.Path) {
-				cookies = append(cookies, cookie)
+			if stored.cookie.Secure && !secure {
+				continue
 			}
+			if crossSite && (stored.cookie.SameSite == SAME_SITE_STRICT ||
+				stored.cookie.SameSite == SAME_SITE_LAX && method != MethodGet && method != MethodHead) {
+				continue
+			}
+			matches = append(matches, stored)
+		}
+		if len(domainCookies) == 0 {
+			delete(cs.cookieMap, domain)
 		}
 	}
+
+	slices.SortStableFunc(matches, func(a, b *storedCookie) int {
+		if len(a.cookie.Path) != len(b.cookie.Path) {
+			return len(b.cookie.Path) - len(a.cookie.Path)
+		}
+		if order := a.creation.Compare(b.creation); order != 0 {
+			return order
+		}
+		return cmp.Compare(a.sequence, b.sequence)
+	})
+	var cookies = make([]*Cookie, 0, len(matches))
+	for _, stored := range matches {
+		cs.accessCounter++
+		stored.lastAccess = cs.accessCounter
+		cookie := stored.cookie
+		cookies = append(cookies, &cookie)
+	}
 	return cookies
 }
 
-func matchesPath(requestPath, cookiePath string) bool {
-	if cookiePath == "" {
+// Returns the domain a cookie is stored under and if it is only sent to the host that set it.
+// Returns false if the cookie must be ignored
+func (cs *CookieStorage) cookieDomain(host string, domainAttribute string) (string, bool, bool) {
+	var domain = canonicalHost(strings.TrimPrefix(domainAttribute, "."))
+	if domain == "" {
+		return host, true, true
+	}
+	if cs.publicSuffix(domain) == domain {
+		// A public suffix can only be set by the host itself, as a host only cookie
+		return host, true, domain == host
+	}
+	if !domainMatches(host, domain) {
+		return "", false, false
+	}
+	return domain, false, true
+}
+
+func (cs *CookieStorage) publicSuffix(domain string) string {
+	if net.ParseIP(domain) != nil {
+		return ""
+	}
+	if cs.PublicSuffixes != nil {
+		return cs.PublicSuffixes.PublicSuffix(domain)
+	}
+	return DefaultPublicSuffixList().PublicSuffix(domain)
+}
+
+// Returns the registrable domain of the host, one label more than its public suffix
+func (cs *CookieStorage) site(host string) string {
+	var suffix = cs.publicSuffix(host)
+	if suffix == "" || suffix == host {
+		return host
+	}
+	var rest = strings.TrimSuffix(host, "."+suffix)
+	return rest[strings.LastIndexByte(rest, '.')+1:] + "." + suffix
+}
+
+func (cs *CookieStorage) isSameSite(url *url.URL, initiator *url.URL) bool {
+	var secure = func(scheme string) bool { return scheme == "https" || scheme == "wss" }
+	return secure(url.Scheme) == secure(initiator.Scheme) &&
+		cs.site(canonicalHost(url.Hostname())) == cs.site(canonicalHost(initiator.Hostname()))
+}
+
+// Removes expired cookies and then the least recently used until the domain and the storage are within their limits.
+// Returns true if a persistent cookie was evicted
+func (cs *CookieStorage) evict(domain string, now time.Time) bool {
+	var maxPerDomain = cs.MaxCookiesPerDomain
+	if maxPerDomain <= 0 {
+		maxPerDomain = DEFAULT_MAX_COOKIES_PER_DOMAIN
+	}
+	var maxCookies = cs.MaxCookies
+	if maxCookies <= 0 {
+		maxCookies = DEFAULT_MAX_COOKIES
+	}
+
+	var total = 0
+	for storedDomain, domainCookies := range cs.cookieMap {
+		for key, stored := range domainCookies {
+			if stored.persistent && !stored.expires.After(now) {
+				delete(domainCookies, key)
+			}
+		}
+		if len(domainCookies) == 0 {
+			delete(cs.cookieMap, storedDomain)
+		}
+		total += len(domainCookies)
+	}
+
+	var persistentRemoved = false
+	for len(cs.cookieMap[domain]) > maxPerDomain {
+		total--
+		if removed := cs.removeLeastRecentlyUsed(domain); removed != nil && removed.persistent {
+			persistentRemoved = true
+		}
+	}
+	for total > maxCookies {
+		total--
+		if removed := cs.removeLeastRecentlyUsed(""); removed != nil && removed.persistent {
+			persistentRemoved = true
+		}
+	}
+	return persistentRemoved
+}
+
+// Removes the least recently used cookie of the domain, or of the whole storage if domain is empty. Returns the removed cookie
+func (cs *CookieStorage) removeLeastRecentlyUsed(domain string) *storedCookie {
+	var oldestDomain string
+	var oldestKey cookieKey
+	var oldest *storedCookie
+	for storedDomain, domainCookies := range cs.cookieMap {
+		if domain != "" && storedDomain != domain {
+			continue
+		}
+		for key, stored := range domainCookies {
+			if oldest == nil || stored.lastAccess < oldest.lastAccess {
+				oldestDomain, oldestKey, oldest = storedDomain, key, stored
+			}
+		}
+	}
+	if oldest == nil {
+		return nil
+	}
+	delete(cs.cookieMap[oldestDomain], oldestKey)
+	if len(cs.cookieMap[oldestDomain]) == 0 {
+		delete(cs.cookieMap, oldestDomain)
+	}
+	return oldest
+}
+
+func canonicalHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// Domain matching of RFC 6265 section 5.1.3
+func domainMatches(host string, domain string) bool {
+	if host == domain {
 		return true
 	}
-	if strings.HasPrefix(requestPath, cookiePath) {
+	return strings.HasSuffix(host, "."+domain) && net.ParseIP(host) == nil
+}
+
+// Path matching of RFC 6265 section 5.1.4
+func pathMatches(requestPath, cookiePath string) bool {
+	if requestPath == cookiePath {
 		return true
 	}
-	return false
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/'
 }
 
+// Default path of RFC 6265 section 5.1.4, the directory of the request path
+func defaultCookiePath(requestPath string) string {
+	if requestPath == "" || requestPath[0] != '/' {
+		return "/"
+	}
+	var lastSlash = strings.LastIndexByte(requestPath, '/')
+	if lastSlash == 0 {
+		return "/"
+	}
+	return requestPath[:lastSlash]
+}
+
+// Parses a Set-Cookie value following RFC 6265 section 5.2. Attributes with bad values are ignored instead of
+// rejecting the cookie and unknown attributes are kept in Unparsed. Returns an error only if there is no name value pair
 func parseSetCookieLine(cookieLine string) (*Cookie, error) {
-	splittedCookie := strings.Split(strings.TrimSpace(cookieLine), ";")
-	if len(splittedCookie) < 1 {
-		return nil, errors.New("bad cookie line")
+	splittedCookie := strings.Split(cookieLine, ";")
+	name, value, found := strings.Cut(splittedCookie[0], "=")
+	name = strings.TrimSpace(name)
+	if !found || name == "" {
+		return nil, errors.New("bad name value pair")
 	}
 	var cookie = &Cookie{
+		Name:     name,
+		Value:    unquoteCookieValue(strings.TrimSpace(value)),
 		creation: time.Now(),
 		SameSite: SAME_SITE_DEFAULT,
 	}
-	valuePair := strings.Split(splittedCookie[0], "=")
-	if len(valuePair) < 2 {
-		return nil, errors.New("bad name value pair")
-	}
-	cookie.Name = valuePair[0]
-	cookie.Value = strings.Join(valuePair[1:], "=")
 
+	var hasMaxAge = false
 	for _, attribute := range splittedCookie[1:] {
-		splittedAttribute := strings.Split(attribute, "=")
-		switch strings.TrimSpace(strings.ToLower(splittedAttribute[0])) {
+		attributeName, attributeValue, _ := strings.Cut(attribute, "=")
+		attributeValue = strings.TrimSpace(attributeValue)
+		switch strings.TrimSpace(strings.ToLower(attributeName)) {
 		case "expires":
-			if !cookie.Expires.IsZero() {
+			if hasMaxAge {
 				continue
 			}
-			if len(splittedAttribute) < 2 {
-				return nil, errors.New("bad attribute")
-			}
-			expireTime, err := time.Parse(time.RFC1123, splittedAttribute[1])
-			if err != nil {
-				return nil, errors.New("bad expire value")
+			if expireTime, err := parseCookieDate(attributeValue); err == nil {
+				cookie.Expires = expireTime
 			}
-			cookie.Expires = expireTime.UTC()
 		case "max-age":
-			if len(splittedAttribute) < 2 {
-				return nil, errors.New("bad attribute")
-			}
-			maxAge, err := strconv.ParseInt(splittedAttribute[1], 10, 64)
-			if err != nil {
-				return nil, errors.New("bad max age value")
+			maxAge, err := strconv.ParseInt(attributeValue, 10, 64)
+			if err != nil || attributeValue[0] == '+' {
+				continue
 			}
+			hasMaxAge = true
 			cookie.MaxAge = int(maxAge)
 			cookie.Expires = cookie.creation.Add(time.Duration(maxAge) * time.Second).UTC()
 		case "secure":
@@ -171,33 +471,197 @@ func parseSetCookieLine(cookieLine string) (*Cookie, error) {
 		case "httponly":
 			cookie.HTTPOnly = true
 		case "domain":
-			if len(splittedAttribute) < 2 {
-				return nil, errors.New("bad attribute")
+			if attributeValue != "" {
+				cookie.Domain = strings.ToLower(strings.TrimPrefix(attributeValue, "."))
 			}
-			cookie.Domain = splittedAttribute[1]
 		case "path":
-			if len(splittedAttribute) < 2 {
-				return nil, errors.New("bad attribute")
+			if strings.HasPrefix(attributeValue, "/") {
+				cookie.Path = attributeValue
 			}
-			cookie.Path = splittedAttribute[1]
 		case "samesite":
-			if len(splittedAttribute) < 2 {
-				return nil, errors.New("bad attribute")
-			}
-			switch strings.ToLower(splittedAttribute[1]) {
+			switch strings.ToLower(attributeValue) {
 			case "lax":
 				cookie.SameSite = SAME_SITE_LAX
 			case "strict":
 				cookie.SameSite = SAME_SITE_STRICT
 			case "none":
 				cookie.SameSite = SAME_SITE_NONE
-				cookie.Secure = true
-			default:
-				return nil, errors.New("bad samesite value")
 			}
+		case "":
 		default:
-			return nil, errors.New("unknown attribute")
+			cookie.Unparsed = append(cookie.Unparsed, strings.TrimSpace(attribute))
 		}
 	}
 	return cookie, nil
 }
+
+// Parses the pairs of a Cookie header. Pairs without a name are skipped and a pair without = is a name with an empty value
+func parseCookieHeader(cookieLine string) map[string]string {
+	var cookies = make(map[string]string)
+	for _, pair := range strings.Split(cookieLine, ";") {
+		name, value, _ := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !isToken(name) {
+			continue
+		}
+		cookies[name] = unquoteCookieValue(strings.TrimSpace(value))
+	}
+	return cookies
+}
+
+func unquoteCookieValue(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// cookie-octet of RFC 6265 section 4.1.1, any visible ASCII except DQUOTE, comma, semicolon and backslash
+func isCookieOctet(b byte) bool {
+	return b >= 0x21 && b <= 0x7e && b != '"' && b != ',' && b != ';' && b != '\\'
+}
+
+func validCookieValue(value string) bool {
+	value = unquoteCookieValue(value)
+	for i := 0; i < len(value); i++ {
+		if !isCookieOctet(value[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Removes the bytes not allowed in a cookie value. Values with spaces or commas are quoted, as browsers accept them that way
+func sanitizeCookieValue(value string) string {
+	var builder strings.Builder
+	var quote = false
+	for i := 0; i < len(value); i++ {
+		if isCookieOctet(value[i]) {
+			builder.WriteByte(value[i])
+		} else if value[i] == ' ' || value[i] == ',' {
+			builder.WriteByte(value[i])
+			quote = true
+		}
+	}
+	if quote {
+		return "\"" + builder.String() + "\""
+	}
+	return builder.String()
+}
+
+// Attribute values can have any character except controls and semicolons
+func validCookieAttributeValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] < 0x20 || value[i] == 0x7f || value[i] == ';' {
+			return false
+		}
+	}
+	return true
+}
+
+func validCookieDomain(domain string) bool {
+	domain = strings.TrimPrefix(domain, ".")
+	if net.ParseIP(domain) != nil {
+		return true
+	}
+	if domain == "" || len(domain) > 255 {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			b := label[i]
+			if !(b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '-' || b == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func validCookieExpires(expires time.Time) bool {
+	return !expires.IsZero() && expires.Year() >= 1601
+}
+
+// Parses a cookie date with the algorithm of RFC 6265 section 5.1.1, which accepts RFC 1123, RFC 850, asctime
+// and the other formats found in practice, like Wed, 09-Jun-2021 10:18:14 GMT
+func parseCookieDate(value string) (time.Time, error) {
+	var hour, minute, second, day, year = -1, -1, -1, -1, -1
+	var month time.Month
+	var isDelimiter = func(r rune) bool {
+		return r == 0x09 || r >= 0x20 && r <= 0x2f || r >= 0x3b && r <= 0x40 || r >= 0x5b && r <= 0x60 || r >= 0x7b && r <= 0x7e
+	}
+	for _, token := range strings.FieldsFunc(value, isDelimiter) {
+		if hour < 0 {
+			if h, m, s, ok := parseCookieTime(token); ok {
+				hour, minute, second = h, m, s
+				continue
+			}
+		}
+		if day < 0 {
+			if digits := leadingDigits(token, 1, 2); digits >= 0 {
+				day = digits
+				continue
+			}
+		}
+		if month == 0 && len(token) >= 3 {
+			if index := strings.Index("janfebmaraprmayjunjulaugsepoctnovdec", strings.ToLower(token[:3])); index >= 0 && index%3 == 0 {
+				month = time.Month(index/3 + 1)
+				continue
+			}
+		}
+		if year < 0 {
+			if digits := leadingDigits(token, 2, 4); digits >= 0 {
+				year = digits
+				continue
+			}
+		}
+	}
+	if year >= 70 && year <= 99 {
+		year += 1900
+	} else if year >= 0 && year <= 69 {
+		year += 2000
+	}
+	if hour < 0 || day < 1 || day > 31 || month == 0 || year < 1601 || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, errors.New("invalid cookie date")
+	}
+	date := time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+	if date.Day() != day {
+		return time.Time{}, errors.New("invalid cookie date")
+	}
+	return date, nil
+}
+
+// Parses hh:mm:ss where each field has one or two digits, ignoring anything after the seconds
+func parseCookieTime(token string) (int, int, int, bool) {
+	parts := strings.SplitN(token, ":", 3)
+	if len(parts) != 3 {
+		return 0, 0, 0, false
+	}
+	var values [3]int
+	for i, part := range parts {
+		if i < 2 && (len(part) < 1 || len(part) > 2) {
+			return 0, 0, 0, false
+		}
+		if values[i] = leadingDigits(part, 1, 2); values[i] < 0 {
+			return 0, 0, 0, false
+		}
+	}
+	return values[0], values[1], values[2], true
+}
+
+// Returns the number made of the digits at the start of token if there are between minDigits and maxDigits
+// of them and they are followed by a non digit or nothing. Returns -1 otherwise
+func leadingDigits(token string, minDigits int, maxDigits int) int {
+	var count = 0
+	for count < len(token) && token[count] >= '0' && token[count] <= '9' {
+		count++
+	}
+	if count < minDigits || count > maxDigits {
+		return -1
+	}
+	number, _ := strconv.Atoi(token[:count])
+	return number
+}
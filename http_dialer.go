@@ -0,0 +1,188 @@
+package easyhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Default delay before racing the next address of a host, as recommended by RFC 8305
+const DEFAULT_FALLBACK_DELAY = 250 * time.Millisecond
+
+// Resolves host names into IP addresses. net.DefaultResolver implements it
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Dialer with hooks for name resolution, host overrides and source address binding.
+// Hosts with several addresses are dialed Happy Eyeballs style as defined by RFC 8305
+type Dialer struct {
+	// Resolves host names. net.DefaultResolver is used if nil
+	Resolver Resolver
+	// Replaces a host, or a host and port, with another address. Addresses like unix:///var/run/app.sock dial a Unix domain socket
+	HostOverrides map[string]string
+	// Local address the connections are bound to
+	LocalAddr net.Addr
+	// Delay before the next address is tried while the previous attempt is still pending. DEFAULT_FALLBACK_DELAY is used if zero
+	// and addresses are tried one at a time if negative
+	FallbackDelay time.Duration
+}
+
+func NewDialer() *Dialer {
+	return &Dialer{HostOverrides: make(map[string]string)}
+}
+
+// Connects to the address on the network. Usable as the DialContext of httpClient
+func (d *Dialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if override, found := d.override(address, host); found {
+		if socketPath, isUnix := strings.CutPrefix(override, "unix://"); isUnix {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		}
+		if overrideHost, overridePort, err := net.SplitHostPort(override); err == nil {
+			host, port = overrideHost, overridePort
+		} else {
+			host = override
+		}
+	}
+
+	dialer := &net.Dialer{LocalAddr: d.LocalAddr}
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, net.JoinHostPort(host, port))
+	}
+
+	var resolver Resolver = net.DefaultResolver
+	if d.Resolver != nil {
+		resolver = d.Resolver
+	}
+	ipAddresses, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []string
+	for _, ipAddress := range interleaveAddresses(ipAddresses, network) {
+		addresses = append(addresses, net.JoinHostPort(ipAddress.String(), port))
+	}
+	if len(addresses) == 0 {
+		return nil, &net.DNSError{Err: "no suitable address found", Name: host}
+	}
+	return d.race(ctx, dialer.DialContext, network, addresses)
+}
+
+func (d *Dialer) override(address string, host string) (string, bool) {
+	if override, found := d.HostOverrides[address]; found {
+		return override, true
+	}
+	override, found := d.HostOverrides[host]
+	return override, found
+}
+
+// Orders the addresses alternating between IPv6 and IPv4, starting with the family of the first one,
+// and drops the addresses that do not belong to the network
+func interleaveAddresses(ipAddresses []net.IPAddr, network string) []net.IPAddr {
+	var primary, fallback []net.IPAddr
+	var primaryIsIPv4 bool
+	for _, ipAddress := range ipAddresses {
+		isIPv4 := ipAddress.IP.To4() != nil
+		if network == "tcp4" && !isIPv4 || network == "tcp6" && isIPv4 {
+			continue
+		}
+		if len(primary) == 0 {
+			primaryIsIPv4 = isIPv4
+		}
+		if isIPv4 == primaryIsIPv4 {
+			primary = append(primary, ipAddress)
+		} else {
+			fallback = append(fallback, ipAddress)
+		}
+	}
+	var ordered = make([]net.IPAddr, 0, len(primary)+len(fallback))
+	for i := 0; i < len(primary) || i < len(fallback); i++ {
+		if i < len(primary) {
+			ordered = append(ordered, primary[i])
+		}
+		if i < len(fallback) {
+			ordered = append(ordered, fallback[i])
+		}
+	}
+	return ordered
+}
+
+type dialResult struct {
+	connection net.Conn
+	err        error
+}
+
+// Dials the addresses in order, starting the next attempt when the previous one fails or after the fallback delay.
+// Returns the first connection established and closes the rest
+func (d *Dialer) race(ctx context.Context, dial DialFunction, network string, addresses []string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var delay = d.FallbackDelay
+	if delay == 0 {
+		delay = DEFAULT_FALLBACK_DELAY
+	}
+	results := make(chan dialResult, len(addresses))
+	var next, pending int
+	startAttempt := func() {
+		address := addresses[next]
+		next++
+		pending++
+		go func() {
+			connection, err := dial(ctx, network, address)
+			results <- dialResult{connection, err}
+		}()
+	}
+
+	startAttempt()
+	var timer *time.Timer
+	var fallback <-chan time.Time
+	if delay > 0 {
+		timer = time.NewTimer(delay)
+		defer timer.Stop()
+		fallback = timer.C
+	}
+	var firstErr error
+	for pending > 0 {
+		select {
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				go closeLateConnections(results, pending)
+				return result.connection, nil
+			}
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			if next < len(addresses) {
+				startAttempt()
+				if timer != nil {
+					timer.Reset(delay)
+				}
+			}
+		case <-fallback:
+			if next < len(addresses) {
+				startAttempt()
+				timer.Reset(delay)
+			}
+		}
+	}
+	if firstErr == nil {
+		firstErr = errors.New("no address to dial")
+	}
+	return nil, firstErr
+}
+
+func closeLateConnections(results chan dialResult, pending int) {
+	for ; pending > 0; pending-- {
+		if result := <-results; result.connection != nil {
+			result.connection.Close()
+		}
+	}
+}
@@ -26,22 +26,6 @@ type httpRequest interface {
 	HasHeaderValue(key string, value string) bool
 }
 
-var mime_types = map[string]string{
-	"txt":  "text/plain",
-	"html": "text/html",
-	"css":  "text/css",
-	"js":   "application/javascript",
-	"json": "application/json",
-	"pdf":  "application/pdf",
-	"xml":  "application/xml",
-	"jpg":  "image/jpeg",
-	"png":  "image/png",
-	"gif":  "image/gif",
-	"mp4":  "video/mp4",
-	"zip":  "application/zip",
-	"svg":  "image/svg+xml",
-}
-
 // HTTP Headers
 type Headers map[string][]string
 
@@ -61,7 +45,7 @@ const (
 	MethodTrace   = "TRACE"
 )
 
-var validMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+var validMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT"}
 var validVersions = []string{"1.0", "1.1"}
 
 var ErrInvalidLength = errors.New("invalid content length")
@@ -73,6 +57,18 @@ var ErrBadRequest = errors.New("bad request")
 var ErrRequestTimeout = errors.New("request timeout")
 var ErrClientTimeout = errors.New("client timeout")
 var ErrInternalError = errors.New("internal error")
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+var ErrContentTooLarge = errors.New("content too large")
+var ErrEventStreamClosed = errors.New("event stream closed")
+var ErrInvalidCookie = errors.New("invalid cookie")
+var ErrCookieNotFound = errors.New("cookie not found")
+var ErrCookieTampered = errors.New("cookie signature or encryption is not valid")
+var ErrCookieExpired = errors.New("cookie expired")
+var ErrSessionNotFound = errors.New("session not found")
+
+// Returned by a CheckRedirect function to stop following redirects and return the last response received
+var ErrUseLastResponse = errors.New("use last response")
 
 // HTTP Status
 const (
@@ -114,6 +110,7 @@ const (
 	STATUS_MISDIRECTED_REQUEST           = 421
 	STATUS_UNPROCESSABLE_CONTENT         = 422
 	STATUS_UPGRADE_REQUIRED              = 426
+	STATUS_TOO_MANY_REQUESTS             = 429
 	STATUS_INTERNAL_ERROR                = 500
 	STATUS_NOT_IMPLEMENTED               = 501
 	STATUS_BAD_GATEWAY                   = 502
@@ -160,6 +157,7 @@ var reasons = map[int]string{
 	STATUS_MISDIRECTED_REQUEST:           "Misdirected Request",
 	STATUS_UNPROCESSABLE_CONTENT:         "Unprocessable Content",
 	STATUS_UPGRADE_REQUIRED:              "Upgrade Required",
+	STATUS_TOO_MANY_REQUESTS:             "Too Many Requests",
 	STATUS_INTERNAL_ERROR:                "Internal Error",
 	STATUS_NOT_IMPLEMENTED:               "Not Implemented",
 	STATUS_BAD_GATEWAY:                   "Bad Gateway",
@@ -170,6 +168,59 @@ var reasons = map[int]string{
 
 const KEEP_ALIVE_TIMEOUT = 5
 
+// Time format used on HTTP date headers
+const HTTP_TIME_FORMAT = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// Splits the value of a header line on commas, except for cookie and authentication fields where commas are part of the value
+func splitHeaderValues(name string, value string) []string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "set-cookie", "cookie", "authorization", "proxy-authorization", "www-authenticate", "proxy-authenticate":
+		return []string{value}
+	}
+	return strings.Split(value, ",")
+}
+
+// Joins header values that were split on commas while parsing back into a single field value
+func joinHeaderValues(values []string) string {
+	return strings.Join(values, ", ")
+}
+
+// Splits value on separator, ignoring separators inside quoted strings
+func splitOutsideQuotes(value string, separator rune) []string {
+	var parts []string
+	var current strings.Builder
+	var quoted = false
+	var escaped = false
+	for _, character := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case character == '\\' && quoted:
+			escaped = true
+		case character == '"':
+			quoted = !quoted
+		case character == separator && !quoted:
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(character)
+	}
+	return append(parts, current.String())
+}
+
+// Parses a HTTP date in any of the formats accepted by RFC 9110 section 5.6.7
+func parseHTTPDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{HTTP_TIME_FORMAT, time.RFC1123, time.RFC850, time.ANSIC} {
+		parsedTime, err := time.Parse(layout, value)
+		if err == nil {
+			return parsedTime.UTC(), nil
+		}
+	}
+	return time.Time{}, errors.New("invalid http date")
+}
+
 func isEmpty(element string) bool {
 	return element == ""
 }
@@ -208,13 +259,132 @@ func isURIMatch(requestPath string, pattern string) bool {
 }
 
 func parseBodyWithFullContent(bodyLength int64, bodyReader *textproto.Reader) ([]byte, error) {
-	var bodyBuffer []byte = make([]byte, bodyLength)
-	readBodyLength, err := io.ReadFull(bodyReader.R, bodyBuffer)
+	return readFullBody(bodyReader.R, bodyLength)
+}
+
+// Reads length bytes, growing the buffer as data arrives so a peer announcing a large length cannot force a large allocation
+func readFullBody(reader io.Reader, length int64) ([]byte, error) {
+	var bodyBuffer = bytes.NewBuffer(make([]byte, 0, min(length, 64*1024)))
+	_, err := io.CopyN(bodyBuffer, reader, length)
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
 	if err != nil {
 		return nil, err
 	}
+	return bodyBuffer.Bytes(), nil
+}
+
+// Maximum number of trailer fields read after the last chunk
+const MAX_TRAILER_FIELDS = 100
+
+// Trailer fields that cannot be sent on trailers as defined in RFC 9110 section 6.5.1
+var forbiddenTrailers = []string{
+	"transfer-encoding", "content-length", "content-encoding", "content-type", "content-range", "trailer", "host",
+	"connection", "keep-alive", "upgrade", "te", "expect", "max-forwards", "range", "cache-control", "pragma",
+	"authorization", "proxy-authorization", "www-authenticate", "proxy-authenticate", "cookie", "set-cookie",
+	"age", "date", "expires", "location", "retry-after", "vary",
+}
+
+func isForbiddenTrailer(name string) bool {
+	return slices.Contains(forbiddenTrailers, strings.ToLower(strings.TrimSpace(name)))
+}
+
+// Parses a chunk size line and its chunk extensions as defined in RFC 9112 section 7.1.1
+func parseChunkSizeLine(line string) (uint64, map[string]string, error) {
+	sizeValue, extensionsValue, _ := strings.Cut(line, ";")
+	chunkLength, err := strconv.ParseUint(strings.TrimSpace(sizeValue), 16, 32)
+	if err != nil {
+		return 0, nil, ErrBadRequest
+	}
 
-	return bodyBuffer[:readBodyLength], nil
+	var extensions map[string]string
+	if extensionsValue != "" {
+		extensions = make(map[string]string)
+		for _, extension := range splitOutsideQuotes(extensionsValue, ';') {
+			name, value, _ := strings.Cut(extension, "=")
+			name = strings.TrimSpace(name)
+			if name == "" {
+				return 0, nil, ErrBadRequest
+			}
+			value = strings.TrimSpace(value)
+			if unquotedValue, err := strconv.Unquote(value); err == nil && strings.HasPrefix(value, "\"") {
+				value = unquotedValue
+			}
+			extensions[strings.ToLower(name)] = value
+		}
+	}
+	return chunkLength, extensions, nil
+}
+
+// Reads the trailer section after the last chunk of a chunked body
+func parseTrailers(bodyReader *textproto.Reader) (Headers, error) {
+	var trailers = make(Headers)
+	for fields := 0; ; fields++ {
+		line, err := bodyReader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		if fields >= MAX_TRAILER_FIELDS {
+			return nil, ErrBadRequest
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, ErrBadRequest
+		}
+		if isForbiddenTrailer(name) {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(name))
+		trailers[key] = append(trailers[key], strings.TrimSpace(value))
+	}
+	return trailers, nil
+}
+
+// Reads the CRLF that ends the data of a chunk
+func readChunkEnd(bodyReader *textproto.Reader) error {
+	line, err := bodyReader.ReadLine()
+	if err != nil {
+		return err
+	}
+	if line != "" {
+		return ErrBadRequest
+	}
+	return nil
+}
+
+// Writes the data as a single chunk. Empty data is skipped since it would end the body
+func writeChunkData(writer io.Writer, chunk []byte) error {
+	if len(chunk) == 0 {
+		return nil
+	}
+	buffer := new(bytes.Buffer)
+	buffer.WriteString(strconv.FormatInt(int64(len(chunk)), 16) + "\r\n")
+	buffer.Write(chunk)
+	buffer.WriteString("\r\n")
+	_, err := writer.Write(buffer.Bytes())
+	return err
+}
+
+// Writes the last chunk followed by the trailer fields
+func writeLastChunk(writer io.Writer, trailers Headers) error {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString("0\r\n")
+	for trailerName, trailerValue := range trailers {
+		if isForbiddenTrailer(trailerName) {
+			continue
+		}
+		buffer.WriteString(trailerName)
+		buffer.WriteString(": ")
+		buffer.WriteString(joinHeaderValues(trailerValue))
+		buffer.WriteString("\r\n")
+	}
+	buffer.WriteString("\r\n")
+	_, err := writer.Write(buffer.Bytes())
+	return err
 }
 
 func parseServerChunkedBody(bodyReader *textproto.Reader, connection net.Conn, request *ServerHTTPRequest, response *ServerHTTPResponse, onChunk ServerChunkFunction) ([]byte, error) {
@@ -222,24 +392,24 @@ func parseServerChunkedBody(bodyReader *textproto.Reader, connection net.Conn, r
 	var isFinished = false
 	for !isFinished {
 		connection.SetReadDeadline(time.Now().Add(KEEP_ALIVE_TIMEOUT * time.Second))
-		firstLine, err := bodyReader.ReadLine()
-		for err != nil || firstLine == "" {
-			firstLine, err = bodyReader.ReadLine()
-			if err != nil {
-				return nil, err
-			}
+		sizeLine, err := bodyReader.ReadLine()
+		if err != nil {
+			return nil, err
 		}
-		firstLine = strings.TrimSpace(firstLine)
-		chunkLength, err := strconv.ParseUint(firstLine, 16, 32)
+		chunkLength, extensions, err := parseChunkSizeLine(sizeLine)
 		if err != nil {
 			return nil, err
 		}
+		request.chunkExtensions = extensions
 		if chunkLength != 0 {
 			var chunkBuffer = make([]byte, chunkLength)
 			read, err := io.ReadFull(bodyReader.R, chunkBuffer)
 			if err != nil {
 				return nil, err
 			}
+			if err = readChunkEnd(bodyReader); err != nil {
+				return nil, err
+			}
 			if onChunk != nil {
 				isFinished = !onChunk(chunkBuffer[:read], *request, response)
 				bodyBytes.Reset()
@@ -247,36 +417,39 @@ func parseServerChunkedBody(bodyReader *textproto.Reader, connection net.Conn, r
 				bodyBytes.Write(chunkBuffer[:read])
 			}
 		} else {
+			request.trailers, err = parseTrailers(bodyReader)
+			if err != nil {
+				return nil, err
+			}
 			isFinished = true
 		}
-		bodyReader.ReadLine()
 	}
 	return bodyBytes.Bytes(), nil
 }
 
-func parseClientChunkedBody(bodyReader *textproto.Reader, connection net.Conn, response *ClientHTTPResponse, onChunk ClientChunkFunction) (*bytes.Buffer, error) {
+func parseClientChunkedBody(bodyReader *textproto.Reader, connection net.Conn, response *ClientHTTPResponse, onChunk ClientChunkFunction, deadlines responseDeadlines) (*bytes.Buffer, error) {
 	var bodyBytes *bytes.Buffer = new(bytes.Buffer)
 	var isFinished = false
 	for !isFinished {
-		connection.SetReadDeadline(time.Now().Add(KEEP_ALIVE_TIMEOUT * time.Second))
-		firstLine, err := bodyReader.ReadLine()
-		for err != nil || firstLine == "" {
-			firstLine, err = bodyReader.ReadLine()
-			if err != nil {
-				return nil, err
-			}
+		deadlines.apply(connection)
+		sizeLine, err := bodyReader.ReadLine()
+		if err != nil {
+			return nil, err
 		}
-		firstLine = strings.TrimSpace(firstLine)
-		chunkLength, err := strconv.ParseUint(firstLine, 16, 32)
+		chunkLength, extensions, err := parseChunkSizeLine(sizeLine)
 		if err != nil {
 			return nil, err
 		}
+		response.chunkExtensions = extensions
 		if chunkLength != 0 {
-			var chunkBuffer = make([]byte, chunkLength)
-			read, err := io.ReadFull(bodyReader.R, chunkBuffer)
+			chunkBuffer, err := readFullBody(bodyReader.R, int64(chunkLength))
 			if err != nil {
 				return nil, err
 			}
+			if err = readChunkEnd(bodyReader); err != nil {
+				return nil, err
+			}
+			read := len(chunkBuffer)
 			if onChunk != nil {
 				isFinished = !onChunk(chunkBuffer[:read], response)
 				bodyBytes.Reset()
@@ -284,14 +457,47 @@ func parseClientChunkedBody(bodyReader *textproto.Reader, connection net.Conn, r
 				bodyBytes.Write(chunkBuffer[:read])
 			}
 		} else {
+			response.trailers, err = parseTrailers(bodyReader)
+			if err != nil {
+				return nil, err
+			}
+			response.bodyComplete = true
 			isFinished = true
 		}
-		bodyReader.ReadLine()
 	}
 
 	return bodyBytes, nil
 }
 
+// Checks if the value is a token as defined by RFC 9110, which is the syntax of methods and header names
+func isToken(value string) bool {
+	if value == "" {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		character := value[i]
+		if character >= 'a' && character <= 'z' || character >= 'A' && character <= 'Z' || character >= '0' && character <= '9' {
+			continue
+		}
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(character)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks if a comma separated header contains the token, ignoring case
+func headerContainsToken(values []string, token string) bool {
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(element), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func isClosingRequest(request httpRequest) bool {
 	if request.Version() == "1.0" {
 		return !request.HasHeaderValue("Connection", "keep-alive")
@@ -0,0 +1,237 @@
+package easyhttp
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Number of bytes considered when sniffing the content type of a body
+const SNIFF_LENGTH = 512
+
+var mimeTypesMutex sync.RWMutex
+
+var mimeTypes = map[string]string{
+	// Text
+	"txt":  "text/plain",
+	"text": "text/plain",
+	"log":  "text/plain",
+	"html": "text/html",
+	"htm":  "text/html",
+	"css":  "text/css",
+	"csv":  "text/csv",
+	"tsv":  "text/tab-separated-values",
+	"md":   "text/markdown",
+	"ics":  "text/calendar",
+	"vtt":  "text/vtt",
+	"yaml": "text/yaml",
+	"yml":  "text/yaml",
+
+	// Application
+	"js":          "application/javascript",
+	"mjs":         "application/javascript",
+	"xml":         "application/xml",
+	"json":        "application/json",
+	"jsonld":      "application/ld+json",
+	"map":         "application/json",
+	"webmanifest": "application/manifest+json",
+	"atom":        "application/atom+xml",
+	"rss":         "application/rss+xml",
+	"xhtml":       "application/xhtml+xml",
+	"pdf":         "application/pdf",
+	"ps":          "application/postscript",
+	"rtf":         "application/rtf",
+	"wasm":        "application/wasm",
+	"zip":         "application/zip",
+	"gz":          "application/gzip",
+	"tgz":         "application/gzip",
+	"tar":         "application/x-tar",
+	"bz2":         "application/x-bzip2",
+	"xz":          "application/x-xz",
+	"7z":          "application/x-7z-compressed",
+	"rar":         "application/vnd.rar",
+	"jar":         "application/java-archive",
+	"epub":        "application/epub+zip",
+	"doc":         "application/msword",
+	"docx":        "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"xls":         "application/vnd.ms-excel",
+	"xlsx":        "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"ppt":         "application/vnd.ms-powerpoint",
+	"pptx":        "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"odt":         "application/vnd.oasis.opendocument.text",
+	"ods":         "application/vnd.oasis.opendocument.spreadsheet",
+	"odp":         "application/vnd.oasis.opendocument.presentation",
+	"sh":          "application/x-sh",
+	"bin":         "application/octet-stream",
+	"exe":         "application/octet-stream",
+	"dmg":         "application/octet-stream",
+	"iso":         "application/octet-stream",
+
+	// Images
+	"png":  "image/png",
+	"apng": "image/apng",
+	"jpg":  "image/jpeg",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+	"svg":  "image/svg+xml",
+	"webp": "image/webp",
+	"avif": "image/avif",
+	"ico":  "image/x-icon",
+	"bmp":  "image/bmp",
+	"tif":  "image/tiff",
+	"tiff": "image/tiff",
+
+	// Fonts
+	"woff":  "font/woff",
+	"woff2": "font/woff2",
+	"ttf":   "font/ttf",
+	"otf":   "font/otf",
+	"eot":   "application/vnd.ms-fontobject",
+
+	// Audio
+	"mp3":  "audio/mpeg",
+	"wav":  "audio/wav",
+	"ogg":  "audio/ogg",
+	"oga":  "audio/ogg",
+	"opus": "audio/opus",
+	"flac": "audio/flac",
+	"aac":  "audio/aac",
+	"m4a":  "audio/mp4",
+	"weba": "audio/webm",
+	"mid":  "audio/midi",
+	"midi": "audio/midi",
+
+	// Video
+	"mp4":  "video/mp4",
+	"m4v":  "video/mp4",
+	"webm": "video/webm",
+	"ogv":  "video/ogg",
+	"mov":  "video/quicktime",
+	"avi":  "video/x-msvideo",
+	"mkv":  "video/x-matroska",
+	"mpeg": "video/mpeg",
+	"mpg":  "video/mpeg",
+	"3gp":  "video/3gpp",
+	"ts":   "video/mp2t",
+}
+
+// Registers the mime type used for files with the given extension, replacing any previous registration.
+// Extensions are matched case insensitively and can be given with or without the leading dot
+func RegisterMimeType(extension string, mimeType string) error {
+	extension = normalizeExtension(extension)
+	if extension == "" {
+		return errors.New("extension cannot be empty")
+	}
+	mimeType = strings.TrimSpace(mimeType)
+	if !strings.Contains(mimeType, "/") {
+		return errors.New("invalid mime type")
+	}
+	mimeTypesMutex.Lock()
+	defer mimeTypesMutex.Unlock()
+	mimeTypes[extension] = mimeType
+	return nil
+}
+
+// Returns the mime type registered for the extension or an empty string if it is unknown.
+// Text types get a charset=utf-8 parameter if they do not define one
+func MimeTypeByExtension(extension string) string {
+	mimeTypesMutex.RLock()
+	mimeType, ok := mimeTypes[normalizeExtension(extension)]
+	mimeTypesMutex.RUnlock()
+	if !ok {
+		return ""
+	}
+	return withDefaultCharset(mimeType)
+}
+
+func normalizeExtension(extension string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(extension), "."))
+}
+
+func withDefaultCharset(mimeType string) string {
+	if strings.HasPrefix(mimeType, "text/") && !strings.Contains(strings.ToLower(mimeType), "charset=") {
+		return mimeType + "; charset=utf-8"
+	}
+	return mimeType
+}
+
+type mimeSignature struct {
+	offset    int
+	signature []byte
+	mimeType  string
+}
+
+var mimeSignatures = []mimeSignature{
+	{offset: 0, signature: []byte("%PDF-"), mimeType: "application/pdf"},
+	{offset: 0, signature: []byte("%!PS-Adobe-"), mimeType: "application/postscript"},
+	{offset: 0, signature: []byte("\xFE\xFF"), mimeType: "text/plain; charset=utf-16be"},
+	{offset: 0, signature: []byte("\xFF\xFE"), mimeType: "text/plain; charset=utf-16le"},
+	{offset: 0, signature: []byte("\xEF\xBB\xBF"), mimeType: "text/plain; charset=utf-8"},
+	{offset: 0, signature: []byte("GIF87a"), mimeType: "image/gif"},
+	{offset: 0, signature: []byte("GIF89a"), mimeType: "image/gif"},
+	{offset: 0, signature: []byte("\x89PNG\r\n\x1A\n"), mimeType: "image/png"},
+	{offset: 0, signature: []byte("\xFF\xD8\xFF"), mimeType: "image/jpeg"},
+	{offset: 0, signature: []byte("BM"), mimeType: "image/bmp"},
+	{offset: 0, signature: []byte("\x00\x00\x01\x00"), mimeType: "image/x-icon"},
+	{offset: 8, signature: []byte("WEBPVP"), mimeType: "image/webp"},
+	{offset: 8, signature: []byte("WAVE"), mimeType: "audio/wav"},
+	{offset: 8, signature: []byte("AVI "), mimeType: "video/x-msvideo"},
+	{offset: 0, signature: []byte("OggS\x00"), mimeType: "application/ogg"},
+	{offset: 0, signature: []byte("ID3"), mimeType: "audio/mpeg"},
+	{offset: 0, signature: []byte("fLaC"), mimeType: "audio/flac"},
+	{offset: 0, signature: []byte("\x1A\x45\xDF\xA3"), mimeType: "video/webm"},
+	{offset: 4, signature: []byte("ftyp"), mimeType: "video/mp4"},
+	{offset: 0, signature: []byte("\x00asm"), mimeType: "application/wasm"},
+	{offset: 0, signature: []byte("wOFF"), mimeType: "font/woff"},
+	{offset: 0, signature: []byte("wOF2"), mimeType: "font/woff2"},
+	{offset: 0, signature: []byte("OTTO"), mimeType: "font/otf"},
+	{offset: 0, signature: []byte("\x00\x01\x00\x00"), mimeType: "font/ttf"},
+	{offset: 0, signature: []byte("PK\x03\x04"), mimeType: "application/zip"},
+	{offset: 0, signature: []byte("\x1F\x8B\x08"), mimeType: "application/gzip"},
+	{offset: 0, signature: []byte("Rar!\x1A\x07"), mimeType: "application/vnd.rar"},
+	{offset: 0, signature: []byte("7z\xBC\xAF\x27\x1C"), mimeType: "application/x-7z-compressed"},
+	{offset: 0, signature: []byte("BZh"), mimeType: "application/x-bzip2"},
+}
+
+var htmlSignatures = []string{
+	"<!DOCTYPE HTML", "<HTML", "<HEAD", "<SCRIPT", "<IFRAME", "<H1", "<DIV", "<FONT",
+	"<TABLE", "<A", "<STYLE", "<TITLE", "<B", "<BODY", "<BR", "<P", "<!--",
+}
+
+// Detects the content type of data by looking at its first SNIFF_LENGTH bytes.
+// Returns application/octet-stream if the data does not look like text or any known format
+func DetectContentType(data []byte) string {
+	if len(data) > SNIFF_LENGTH {
+		data = data[:SNIFF_LENGTH]
+	}
+
+	for _, signature := range mimeSignatures {
+		if len(data) >= signature.offset+len(signature.signature) && bytes.Equal(data[signature.offset:signature.offset+len(signature.signature)], signature.signature) {
+			if signature.offset == 8 && !bytes.HasPrefix(data, []byte("RIFF")) {
+				continue
+			}
+			return signature.mimeType
+		}
+	}
+
+	trimmedData := bytes.TrimLeft(data, "\t\n\x0C\r ")
+	upperData := bytes.ToUpper(trimmedData)
+	for _, signature := range htmlSignatures {
+		if bytes.HasPrefix(upperData, []byte(signature)) && len(upperData) > len(signature) {
+			if next := upperData[len(signature)]; next == ' ' || next == '>' {
+				return "text/html; charset=utf-8"
+			}
+		}
+	}
+	if bytes.HasPrefix(trimmedData, []byte("<?xml")) {
+		return "text/xml; charset=utf-8"
+	}
+
+	for _, character := range data {
+		if character <= 0x08 || character == 0x0B || (character >= 0x0E && character <= 0x1A) || (character >= 0x1C && character <= 0x1F) {
+			return "application/octet-stream"
+		}
+	}
+	return "text/plain; charset=utf-8"
+}
@@ -0,0 +1,80 @@
+package easyhttp
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Finds the public suffix of a domain, the part under which anyone can register names, like com or co.uk
+type PublicSuffixList interface {
+	// Returns the public suffix of the lowercase domain
+	PublicSuffix(domain string) string
+}
+
+const (
+	suffixRule = iota + 1
+	suffixException
+)
+
+type publicSuffixRules map[string]int
+
+//go:embed public_suffix_list.dat
+var defaultPublicSuffixData string
+
+var defaultPublicSuffixes = sync.OnceValue(func() PublicSuffixList {
+	list, err := ParsePublicSuffixList(strings.NewReader(defaultPublicSuffixData))
+	if err != nil {
+		panic(err)
+	}
+	return list
+})
+
+// Returns the snapshot of the public suffix list embedded in the package.
+// It is used by cookie storages without a list of their own and only holds the most common rules
+func DefaultPublicSuffixList() PublicSuffixList {
+	return defaultPublicSuffixes()
+}
+
+// Parses a list in the format of the list at publicsuffix.org, so a copy can be embedded in the program.
+// Rules are matched as written, so internationalized rules only match hosts in the same form
+func ParsePublicSuffixList(reader io.Reader) (PublicSuffixList, error) {
+	var rules = make(publicSuffixRules)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule := strings.ToLower(fields[0])
+		if exception, found := strings.CutPrefix(rule, "!"); found {
+			rules[exception] = suffixException
+		} else {
+			rules[rule] = suffixRule
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Returns the suffix matched by the longest rule, or the last label if no rule matches
+func (p publicSuffixRules) PublicSuffix(domain string) string {
+	labels := strings.Split(domain, ".")
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+		switch p[candidate] {
+		case suffixException:
+			return strings.Join(labels[i+1:], ".")
+		case suffixRule:
+			return candidate
+		}
+		if i+1 < len(labels) && p["*."+strings.Join(labels[i+1:], ".")] == suffixRule {
+			return candidate
+		}
+	}
+	return labels[len(labels)-1]
+}
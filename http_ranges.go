@@ -0,0 +1,189 @@
+package easyhttp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Range of bytes requested by a client
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.start+br.length-1, size)
+}
+
+var errInvalidRange = errors.New("invalid range")
+
+// Parses a Range header value as defined in RFC 9110 section 14.1.2.
+// Returns errInvalidRange if the header should be ignored and ErrRangeNotSatisfiable if no range can be served
+func parseRangeHeader(rangeHeader string, size int64) ([]byteRange, error) {
+	unit, rangeSet, found := strings.Cut(strings.TrimSpace(rangeHeader), "=")
+	if !found || strings.ToLower(strings.TrimSpace(unit)) != "bytes" {
+		return nil, errInvalidRange
+	}
+
+	var ranges []byteRange
+	var noOverlap = false
+	for _, rangeSpec := range strings.Split(rangeSet, ",") {
+		rangeSpec = strings.TrimSpace(rangeSpec)
+		if rangeSpec == "" {
+			continue
+		}
+		firstValue, lastValue, found := strings.Cut(rangeSpec, "-")
+		if !found {
+			return nil, errInvalidRange
+		}
+		firstValue = strings.TrimSpace(firstValue)
+		lastValue = strings.TrimSpace(lastValue)
+
+		var currentRange byteRange
+		if firstValue == "" {
+			suffixLength, err := strconv.ParseInt(lastValue, 10, 64)
+			if err != nil || suffixLength < 0 {
+				return nil, errInvalidRange
+			}
+			if suffixLength == 0 || size == 0 {
+				noOverlap = true
+				continue
+			}
+			if suffixLength > size {
+				suffixLength = size
+			}
+			currentRange = byteRange{start: size - suffixLength, length: suffixLength}
+		} else {
+			firstPosition, err := strconv.ParseInt(firstValue, 10, 64)
+			if err != nil || firstPosition < 0 {
+				return nil, errInvalidRange
+			}
+			var lastPosition = size - 1
+			if lastValue != "" {
+				lastPosition, err = strconv.ParseInt(lastValue, 10, 64)
+				if err != nil || lastPosition < firstPosition {
+					return nil, errInvalidRange
+				}
+				if lastPosition >= size {
+					lastPosition = size - 1
+				}
+			}
+			if firstPosition >= size {
+				noOverlap = true
+				continue
+			}
+			currentRange = byteRange{start: firstPosition, length: lastPosition - firstPosition + 1}
+		}
+		ranges = append(ranges, currentRange)
+	}
+
+	if len(ranges) == 0 {
+		if noOverlap {
+			return nil, ErrRangeNotSatisfiable
+		}
+		return nil, errInvalidRange
+	}
+	return ranges, nil
+}
+
+// Checks if the If-Range precondition holds for the current response representation
+func ifRangeMatches(ifRange string, response *ServerHTTPResponse) bool {
+	ifRange = strings.TrimSpace(ifRange)
+	if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+		etag := response.GetHeader("ETag")
+		if etag == nil {
+			return false
+		}
+		return strongETagMatch(ifRange, joinHeaderValues(etag))
+	}
+
+	ifRangeDate, err := parseHTTPDate(ifRange)
+	if err != nil {
+		return false
+	}
+	lastModifiedHeader := response.GetHeader("Last-Modified")
+	if lastModifiedHeader == nil {
+		return false
+	}
+	lastModified, err := parseHTTPDate(joinHeaderValues(lastModifiedHeader))
+	if err != nil {
+		return false
+	}
+	return lastModified.Equal(ifRangeDate)
+}
+
+func strongETagMatch(first string, second string) bool {
+	if strings.HasPrefix(first, "W/") || strings.HasPrefix(second, "W/") {
+		return false
+	}
+	return first == second
+}
+
+func newMultipartBoundary() string {
+	randomBytes := make([]byte, 16)
+	rand.Read(randomBytes)
+	return hex.EncodeToString(randomBytes)
+}
+
+// Rewrites a complete response into a partial response if the request asked for byte ranges and the response accepts them
+func applyRangeRequest(request *ServerHTTPRequest, response *ServerHTTPResponse) {
+	if request.method != MethodGet || response.statusCode != STATUS_OK || response.chunked {
+		return
+	}
+	if !response.HasHeaderValue("Accept-Ranges", "bytes") || !request.ExistsHeader("Range") {
+		return
+	}
+	if request.ExistsHeader("If-Range") && !ifRangeMatches(joinHeaderValues(request.GetHeader("If-Range")), response) {
+		return
+	}
+
+	content := response.body.Bytes()
+	var size = int64(len(content))
+	ranges, err := parseRangeHeader(joinHeaderValues(request.GetHeader("Range")), size)
+	if err == ErrRangeNotSatisfiable {
+		response.SetStatus(STATUS_RANGE_NOT_SATISFIABLE)
+		response.SetHeader("Content-Range", fmt.Sprintf("bytes */%d", size))
+		response.body = new(bytes.Buffer)
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var totalLength int64
+	for _, currentRange := range ranges {
+		totalLength += currentRange.length
+	}
+	if totalLength > size {
+		return
+	}
+
+	partialBody := new(bytes.Buffer)
+	if len(ranges) == 1 {
+		currentRange := ranges[0]
+		response.SetHeader("Content-Range", currentRange.contentRange(size))
+		partialBody.Write(content[currentRange.start : currentRange.start+currentRange.length])
+	} else {
+		var contentType = "application/octet-stream"
+		if contentTypeHeader := response.GetHeader("Content-Type"); contentTypeHeader != nil {
+			contentType = joinHeaderValues(contentTypeHeader)
+		}
+		boundary := newMultipartBoundary()
+		for _, currentRange := range ranges {
+			partialBody.WriteString("--" + boundary + "\r\n")
+			partialBody.WriteString("Content-Type: " + contentType + "\r\n")
+			partialBody.WriteString("Content-Range: " + currentRange.contentRange(size) + "\r\n\r\n")
+			partialBody.Write(content[currentRange.start : currentRange.start+currentRange.length])
+			partialBody.WriteString("\r\n")
+		}
+		partialBody.WriteString("--" + boundary + "--\r\n")
+		response.SetHeader("Content-Type", "multipart/byteranges; boundary="+boundary)
+	}
+	response.SetStatus(STATUS_PARTIAL_CONTENT)
+	response.body = partialBody
+}
@@ -22,8 +22,13 @@ type HTTPServer struct {
 	patterns    []string
 	running     bool
 	waitGroup   sync.WaitGroup
+	middlewares []Middleware
+	// Handler for CONNECT requests, which have no path
+	connectHandler *responseHandler
 	// Server Timeout
 	timeout time.Duration
+	// Maximum size of a decompressed request body. Request decompression is disabled if zero
+	maxDecompressedSize int64
 }
 
 // Function that sets server request timeout
@@ -31,9 +36,30 @@ func (s *HTTPServer) SetTimeout(timeout_ms time.Duration) {
 	s.timeout = timeout_ms
 }
 
+// Enables transparent decompression of gzip and deflate request bodies up to maxDecompressedSize bytes.
+// Handlers with an onChunk function receive the chunks as they were sent
+func (s *HTTPServer) EnableRequestDecompression(maxDecompressedSize int64) {
+	s.maxDecompressedSize = maxDecompressedSize
+}
+
 // Function that responds to HTTP Requests
 type ResponseFunction func(ServerHTTPRequest, *ServerHTTPResponse)
 
+// Function that wraps a ResponseFunction to run code before and after it
+type Middleware func(ResponseFunction) ResponseFunction
+
+// Add middleware that runs around every handler of the server. Middlewares run in the order they are added
+func (s *HTTPServer) Use(middleware Middleware) {
+	s.middlewares = append(s.middlewares, middleware)
+}
+
+func (s *HTTPServer) applyMiddlewares(handlerFunction ResponseFunction) ResponseFunction {
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		handlerFunction = s.middlewares[i](handlerFunction)
+	}
+	return handlerFunction
+}
+
 // Function that responds to HTTP Request Chunk
 type ServerChunkFunction func([]byte, ServerHTTPRequest, *ServerHTTPResponse) bool
 
@@ -201,19 +227,43 @@ func (s *HTTPServer) HandlePATCHWithOptions(uriPattern string, handlerFunction R
 	s.addHandlerForMethod(handler, MethodPatch)
 }
 
+// Add Handler for CONNECT requests. The tunnel target is given by request.Host() and
+// the handler usually hijacks the connection to relay data to it
+func (s *HTTPServer) HandleCONNECT(handlerFunction ResponseFunction) {
+	var handler *responseHandler = new(responseHandler)
+	handler.handler = handlerFunction
+	s.connectHandler = handler
+}
+
 func handleConnection(connection net.Conn, server *HTTPServer) {
-	defer connection.Close()
-	defer server.waitGroup.Done()
+	var hijacked = false
+	defer func() {
+		if !hijacked {
+			connection.Close()
+			server.waitGroup.Done()
+		}
+	}()
 	var keepAlive = true
+	var connectionReader = bufio.NewReader(connection)
+	var cancelRequest context.CancelFunc
+	defer func() {
+		if cancelRequest != nil {
+			cancelRequest()
+		}
+	}()
 	for server.running && keepAlive {
-		var requestReader = textproto.NewReader(bufio.NewReader(connection))
+		var requestReader = textproto.NewReader(connectionReader)
 		connection.SetReadDeadline(time.Now().Add(KEEP_ALIVE_TIMEOUT * time.Second))
 		request, err := parseRequestFromConnection(requestReader)
 		if err != nil {
 			sendErrorResponse(err, connection)
 			return
 		}
+		request.ctx, request.cancel = context.WithCancel(context.Background())
+		cancelRequest = request.cancel
 		response := newHTTPResponse(request, connection)
+		response.reader = connectionReader
+		response.onHijack = server.waitGroup.Done
 
 		handler, err := getRequestHandler(server, request)
 		if err != nil {
@@ -234,16 +284,30 @@ func handleConnection(connection net.Conn, server *HTTPServer) {
 				return
 			}
 
+			if server.maxDecompressedSize > 0 && handler.options.onChunk == nil {
+				err = decompressRequestBody(request, server.maxDecompressedSize)
+				if err != nil {
+					sendErrorResponse(err, connection)
+					return
+				}
+			}
+
 			err = executeRequest(server, handler, request, response, connection)
+			if response.isHijacked() {
+				hijacked = true
+				return
+			}
 			if err != nil {
-				sendErrorResponse(err, connection)
+				if !response.isStreaming() {
+					sendErrorResponse(err, connection)
+				}
 				return
 			}
+			if request.method == MethodGet || request.method == MethodHead {
+				evaluatePreconditions(request, response)
+			}
+			applyRangeRequest(request, response)
 		}
-		if request.method == MethodHead {
-			response.body = nil
-		}
-
 		if !response.chunked {
 			responseBytes, err := response.toBytes()
 			if err != nil {
@@ -252,9 +316,10 @@ func handleConnection(connection net.Conn, server *HTTPServer) {
 			}
 			connection.Write(responseBytes)
 		} else {
-			connection.Write([]byte("0 \r\n\r\n"))
+			response.finishChunked()
 		}
-		keepAlive = !isClosingRequest(request)
+		keepAlive = !isClosingRequest(request) && !response.isEventStream()
+		request.cancelContext()
 	}
 }
 
@@ -277,16 +342,24 @@ func executeRequest(server *HTTPServer, handler *responseHandler, request *Serve
 					runtime.Goexit()
 				}
 			}()
-			handler.handler(*request, response)
+			server.applyMiddlewares(handler.handler)(*request, response)
 			executionChannel <- nil
 		}()
 		select {
 		case <-executionContext.Done():
-			sendErrorResponse(ErrRequestTimeout, connection)
-			return ErrRequestTimeout
+			if !response.isStreaming() {
+				sendErrorResponse(ErrRequestTimeout, connection)
+				return ErrRequestTimeout
+			}
+			// Event streams and hijacked connections run until the handler returns
+			if executionError := <-executionChannel; executionError != nil {
+				return executionError
+			}
 		case executionError := <-executionChannel:
 			if executionError != nil {
-				sendErrorResponse(executionError, connection)
+				if !response.isStreaming() {
+					sendErrorResponse(executionError, connection)
+				}
 				return executionError
 			}
 		}
@@ -308,6 +381,10 @@ func sendErrorResponse(err error, connection net.Conn) {
 			errorResponse = newBadRequestResponse()
 		} else if err == ErrRequestTimeout {
 			errorResponse = newRequestTimeoutErrorResponse()
+		} else if err == ErrUnsupportedMediaType {
+			errorResponse = newUnsupportedMediaTypeResponse()
+		} else if err == ErrContentTooLarge {
+			errorResponse = newContentTooLargeResponse()
 		} else {
 			errorResponse = newInternalErrorResponse()
 		}
@@ -318,6 +395,12 @@ func sendErrorResponse(err error, connection net.Conn) {
 
 func getRequestHandler(server *HTTPServer, request *ServerHTTPRequest) (*responseHandler, error) {
 	var method = request.method
+	if method == MethodConnect {
+		if server.connectHandler == nil {
+			return nil, ErrMethodNotAllowed
+		}
+		return server.connectHandler, nil
+	}
 	if method == MethodHead {
 		method = MethodGet
 	}
@@ -1,7 +1,9 @@
 package easyhttp
 
 import (
+	"context"
 	"errors"
+	"maps"
 	"net"
 	"net/textproto"
 	"net/url"
@@ -20,6 +22,14 @@ type ServerHTTPRequest struct {
 	chunkChannel chan []byte
 	chunked      bool
 	cookies      map[string]string
+	trailers     Headers
+	// Extensions of the last chunk received
+	chunkExtensions map[string]string
+	ctx             context.Context
+	cancel          context.CancelFunc
+	session         *Session
+	// User authenticated by the BasicAuth or DigestAuth middleware
+	authenticatedUser string
 }
 
 func (r *ServerHTTPRequest) SetHeader(key string, value string) {
@@ -57,6 +67,35 @@ func (r *ServerHTTPRequest) Cookies() map[string]string {
 	return r.cookies
 }
 
+// Returns the session of the request. Nil unless the Sessions middleware is used
+func (r *ServerHTTPRequest) Session() *Session {
+	return r.session
+}
+
+// Returns the trailer fields received after the last chunk of a chunked request
+func (r *ServerHTTPRequest) Trailers() Headers {
+	return r.trailers
+}
+
+// Returns the extensions of the last chunk received. Useful inside an onChunk function
+func (r *ServerHTTPRequest) ChunkExtensions() map[string]string {
+	return r.chunkExtensions
+}
+
+// Returns the request context. It is cancelled when the request finishes or the client disconnects from an event stream
+func (r *ServerHTTPRequest) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+func (r *ServerHTTPRequest) cancelContext() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
 func (r *ServerHTTPRequest) ExistsHeader(key string) bool {
 	_, found := r.headers[strings.ToLower(key)]
 	return found
@@ -70,6 +109,14 @@ func (r *ServerHTTPRequest) Version() string {
 	return r.version
 }
 
+// Returns the host the request is for. For CONNECT requests this is the host and port of the tunnel target
+func (r *ServerHTTPRequest) Host() string {
+	if r.uri != nil && r.uri.Host != "" {
+		return r.uri.Host
+	}
+	return joinHeaderValues(r.GetHeader("Host"))
+}
+
 func (r *ServerHTTPRequest) Path() string {
 	return r.uri.Path
 }
@@ -136,11 +183,19 @@ func parseRequestLine(requestLine string, request *ServerHTTPRequest) error {
 	request.method = method
 
 	var requestUri = requestLineSplit[1]
-	parsedUri, err := url.ParseRequestURI(requestUri)
-	if err != nil {
-		return ErrBadRequest
+	if method == MethodConnect {
+		host, port, err := net.SplitHostPort(requestUri)
+		if err != nil || host == "" || port == "" {
+			return ErrBadRequest
+		}
+		request.uri = &url.URL{Host: requestUri}
+	} else {
+		parsedUri, err := url.ParseRequestURI(requestUri)
+		if err != nil {
+			return ErrBadRequest
+		}
+		request.uri = parsedUri
 	}
-	request.uri = parsedUri
 
 	var version = requestLineSplit[2]
 	versionSplit := strings.Split(version, "/")
@@ -163,7 +218,7 @@ func parseHeadersAndCookies(requestReader *textproto.Reader, request *ServerHTTP
 		}
 		headerSplit := strings.Split(line, ":")
 		if len(headerSplit) >= 2 {
-			for _, value := range strings.Split(strings.Join(headerSplit[1:], ":"), ",") {
+			for _, value := range splitHeaderValues(headerSplit[0], strings.Join(headerSplit[1:], ":")) {
 				request.AddHeader(headerSplit[0], strings.TrimSpace(value))
 			}
 		}
@@ -171,10 +226,7 @@ func parseHeadersAndCookies(requestReader *textproto.Reader, request *ServerHTTP
 	var cookies = make(map[string]string)
 	cookieHeader := request.GetHeader("cookie")
 	for _, cookieLine := range cookieHeader {
-		for _, cookie := range strings.Split(strings.TrimSpace(cookieLine), ";") {
-			cookiesValues := strings.Split(cookie, "=")
-			cookies[cookiesValues[0]] = cookiesValues[1]
-		}
+		maps.Copy(cookies, parseCookieHeader(cookieLine))
 	}
 	delete(request.headers, "cookie")
 	request.cookies = cookies
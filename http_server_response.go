@@ -1,6 +1,7 @@
 package easyhttp
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
@@ -10,8 +11,10 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,6 +27,19 @@ type ServerHTTPResponse struct {
 	chunked     bool
 	method      string
 	cookies     []*Cookie
+	request     *ServerHTTPRequest
+	compression *responseCompression
+	compressor  *chunkCompressor
+	trailers    Headers
+	connection  net.Conn
+	reader      *bufio.Reader
+	// Guards chunk writes of event streams, which can come from the heartbeat goroutine
+	streamMutex  *sync.Mutex
+	eventStream  bool
+	streamClosed bool
+	hijacked     bool
+	// Runs when the connection is hijacked to release it from the server
+	onHijack func()
 }
 
 func (r *ServerHTTPResponse) Write(p []byte) (n int, err error) {
@@ -36,24 +52,37 @@ func (r *ServerHTTPResponse) SendFile(fileName string) error {
 		return err
 	}
 	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
 	fileBytes, err := io.ReadAll(file)
 	if err != nil {
 		return err
 	}
 	r.body.Write(fileBytes)
-	extension := filepath.Ext(fileName)[1:]
-
-	content_type, ok := mime_types[extension]
-	if !ok {
-		r.SetHeader("Content-Type", "application/octet-stream")
-	} else {
-		r.SetHeader("Content-Type", content_type)
+	r.SetHeader("Accept-Ranges", "bytes")
+	if !r.ExistsHeader("ETag") {
+		r.SetETag(fmt.Sprintf("%x-%x", fileInfo.ModTime().UnixNano(), fileInfo.Size()), false)
 	}
+	if !r.ExistsHeader("Last-Modified") {
+		r.SetLastModified(fileInfo.ModTime())
+	}
+	contentType := MimeTypeByExtension(filepath.Ext(fileName))
+	if contentType == "" {
+		contentType = DetectContentType(fileBytes)
+	}
+	r.SetHeader("Content-Type", contentType)
 	return nil
 }
 
-func (r *ServerHTTPResponse) SetCookie(cookie *Cookie) {
+// Adds a Set-Cookie field to the response. Cookies that are not valid are not sent and the error of Valid is returned
+func (r *ServerHTTPResponse) SetCookie(cookie *Cookie) error {
+	if err := cookie.Valid(); err != nil {
+		return err
+	}
 	r.cookies = append(r.cookies, cookie)
+	return nil
 }
 
 func (r *ServerHTTPResponse) SendChunk() (int, error) {
@@ -62,6 +91,9 @@ func (r *ServerHTTPResponse) SendChunk() (int, error) {
 	}
 	if !r.chunked {
 		r.chunked = true
+		if err := r.startChunkCompression(); err != nil {
+			return 0, err
+		}
 		responseBytes, err := r.toBytes()
 		if err != nil {
 			return 0, err
@@ -69,21 +101,139 @@ func (r *ServerHTTPResponse) SendChunk() (int, error) {
 		r.chunkWriter.Write(responseBytes)
 	}
 
-	buffer := new(bytes.Buffer)
 	var chunkLength = r.body.Len()
 	if chunkLength <= 0 {
 		return 0, errors.New("chunk size cannot be 0")
 	}
-	chunkLengthLine := fmt.Sprintf("%x \r\n", chunkLength)
+	var chunk = r.body.Bytes()
+	if r.compressor != nil {
+		compressedChunk, err := r.compressor.compress(chunk)
+		if err != nil {
+			return 0, err
+		}
+		chunk = compressedChunk
+	}
+	if err := r.writeChunk(chunk); err != nil {
+		return 0, err
+	}
+
+	r.body.Reset()
+	return chunkLength, nil
+}
+
+func (r *ServerHTTPResponse) writeChunk(chunk []byte) error {
+	if len(chunk) == 0 {
+		return nil
+	}
+	buffer := new(bytes.Buffer)
+	chunkLengthLine := fmt.Sprintf("%x\r\n", len(chunk))
 	buffer.WriteString(chunkLengthLine)
-	buffer.Write(r.body.Bytes())
+	buffer.Write(chunk)
 
 	buffer.WriteString("\r\n")
 
-	r.chunkWriter.Write(buffer.Bytes())
+	_, err := r.chunkWriter.Write(buffer.Bytes())
+	return err
+}
+
+// Writes the last chunk of a chunked response
+func (r *ServerHTTPResponse) finishChunked() {
+	r.streamMutex.Lock()
+	defer r.streamMutex.Unlock()
+	r.streamClosed = true
+	if r.compressor != nil {
+		lastChunk, err := r.compressor.close()
+		if err == nil {
+			r.writeChunk(lastChunk)
+		}
+	}
+	writeLastChunk(r.chunkWriter, r.trailers)
+}
+
+// Announces a trailer field on the Trailer header. Must be called before the first chunk is sent
+func (r *ServerHTTPResponse) DeclareTrailer(key string) {
+	r.AddHeader("Trailer", strings.TrimSpace(key))
+}
+
+// Sets a trailer field sent after the last chunk of a chunked response
+func (r *ServerHTTPResponse) SetTrailer(key string, value string) {
+	r.trailers[strings.ToLower(strings.TrimSpace(key))] = []string{strings.TrimSpace(value)}
+}
+
+// Takes over the connection of the request. The server stops handling the connection, does not wait for it
+// on a graceful shutdown and never closes it, so the caller is responsible for closing it.
+// The buffered reader can hold data the client already sent after the request
+func (r *ServerHTTPResponse) Hijack() (net.Conn, *bufio.Reader, error) {
+	r.streamMutex.Lock()
+	defer r.streamMutex.Unlock()
+	return r.hijackLocked()
+}
+
+func (r *ServerHTTPResponse) hijackLocked() (net.Conn, *bufio.Reader, error) {
+	if r.hijacked {
+		return nil, nil, errors.New("connection was already hijacked")
+	}
+	if r.chunked {
+		return nil, nil, errors.New("response was already sent")
+	}
+	if r.connection == nil {
+		return nil, nil, errors.New("response has no connection")
+	}
+	r.hijacked = true
+	r.connection.SetDeadline(time.Time{})
+	if r.onHijack != nil {
+		r.onHijack()
+	}
+	reader := r.reader
+	if reader == nil {
+		reader = bufio.NewReader(r.connection)
+	}
+	return r.connection, reader, nil
+}
 
+// Switches the connection to protocol, sending a 101 Switching Protocols response with the headers already set,
+// and hijacks it. The client must have offered protocol on its Upgrade header
+func (r *ServerHTTPResponse) Upgrade(protocol string) (net.Conn, *bufio.Reader, error) {
+	protocol = strings.TrimSpace(protocol)
+	if protocol == "" {
+		return nil, nil, errors.New("upgrade protocol cannot be empty")
+	}
+	if r.request == nil || r.request.version != "1.1" || !headerContainsToken(r.request.GetHeader("Upgrade"), protocol) {
+		return nil, nil, errors.New("client did not request an upgrade to " + protocol)
+	}
+	r.streamMutex.Lock()
+	defer r.streamMutex.Unlock()
+	if r.hijacked || r.chunked {
+		return nil, nil, errors.New("response was already sent")
+	}
+	r.SetStatus(STATUS_SWITCHING_PROTOCOL)
+	r.SetHeader("Upgrade", protocol)
+	r.SetHeader("Connection", "Upgrade")
 	r.body.Reset()
-	return chunkLength, nil
+	responseBytes, err := r.toBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.connection == nil {
+		return nil, nil, errors.New("response has no connection")
+	}
+	if _, err = r.connection.Write(responseBytes); err != nil {
+		return nil, nil, err
+	}
+	return r.hijackLocked()
+}
+
+func (r *ServerHTTPResponse) isHijacked() bool {
+	r.streamMutex.Lock()
+	defer r.streamMutex.Unlock()
+	return r.hijacked
+}
+
+// Checks if the handler keeps writing to the connection after the response headers were sent
+func (r *ServerHTTPResponse) isStreaming() bool {
+	r.streamMutex.Lock()
+	defer r.streamMutex.Unlock()
+	return r.eventStream || r.hijacked
 }
 
 func (r *ServerHTTPResponse) HasBody() bool {
@@ -120,6 +270,15 @@ func (r *ServerHTTPResponse) AddHeader(key string, value string) {
 	r.headers[strings.ToLower(strings.TrimSpace(key))] = headers
 }
 
+func (r *ServerHTTPResponse) HasHeaderValue(key string, value string) bool {
+	headers, found := r.headers[strings.ToLower(key)]
+	if found && slices.Contains(headers, value) {
+		return true
+	} else {
+		return false
+	}
+}
+
 func (r *ServerHTTPResponse) ExistsHeader(key string) bool {
 	_, found := r.headers[strings.ToLower(key)]
 	return found
@@ -137,8 +296,23 @@ func (r *ServerHTTPResponse) toBytes() ([]byte, error) {
 
 	addEssentialHTTPHeaders(r)
 
+	var headCompressed = false
+	if r.method == MethodHead && !r.chunked && r.shouldCompressBody() {
+		// HEAD responses get the same headers as GET but their body is never sent, so it is not compressed
+		r.setCompressionHeaders()
+		headCompressed = true
+	} else if !r.chunked {
+		if err := r.compressBody(); err != nil {
+			return nil, err
+		}
+	}
+
 	if r.chunked {
 		r.SetHeader("Transfer-Encoding", "chunked")
+	} else if r.statusCode == STATUS_NOT_MODIFIED || r.statusCode < 200 {
+		delete(r.headers, "content-length")
+	} else if headCompressed {
+		delete(r.headers, "content-length")
 	} else if r.body != nil && r.body.Len() > 0 {
 		if !r.ExistsHeader("Content-Type") {
 			r.SetHeader("Content-Type", "text/plain")
@@ -175,7 +349,7 @@ func (r *ServerHTTPResponse) toBytes() ([]byte, error) {
 
 	contentLengthHeader := r.GetHeader("Content-Length")
 
-	if contentLengthHeader != nil && !r.chunked {
+	if contentLengthHeader != nil && !r.chunked && r.method != MethodHead {
 		contentLengthValue := contentLengthHeader[len(contentLengthHeader)-1]
 		bodyLength, err := strconv.ParseInt(contentLengthValue, 10, 32)
 		if err != nil {
@@ -206,9 +380,13 @@ func newHTTPResponse(request *ServerHTTPRequest, connection net.Conn) *ServerHTT
 		statusCode:  STATUS_OK,
 		body:        new(bytes.Buffer),
 		chunkWriter: connection,
+		connection:  connection,
+		streamMutex: new(sync.Mutex),
 		version:     request.version,
 		method:      request.method,
 		cookies:     make([]*Cookie, 0, 5),
+		request:     request,
+		trailers:    make(Headers),
 	}
 	return response
 }
@@ -240,6 +418,25 @@ func newRequestTimeoutErrorResponse() ServerHTTPResponse {
 	return badRequestResponse
 }
 
+func newUnsupportedMediaTypeResponse() ServerHTTPResponse {
+	badRequestResponse := ServerHTTPResponse{
+		version:    "1.0",
+		statusCode: STATUS_UNSUPPORTED_MEDIA_TYPE,
+		headers:    make(Headers),
+	}
+	badRequestResponse.SetHeader("Accept-Encoding", "gzip, deflate")
+	return badRequestResponse
+}
+
+func newContentTooLargeResponse() ServerHTTPResponse {
+	badRequestResponse := ServerHTTPResponse{
+		version:    "1.0",
+		statusCode: STATUS_CONTENT_TOO_LARGE,
+		headers:    make(Headers),
+	}
+	return badRequestResponse
+}
+
 func newInvalidLengthResponse() ServerHTTPResponse {
 	badRequestResponse := ServerHTTPResponse{
 		version:    "1.0",
@@ -273,7 +470,7 @@ func addEssentialHTTPHeaders(response *ServerHTTPResponse) {
 	response.SetHeader("Server", softwareName)
 
 	if response.statusCode == STATUS_UNAUTHORIZED {
-		if _, exists := response.headers["WWW-Authenticate"]; !exists {
+		if !response.ExistsHeader("WWW-Authenticate") {
 			log.Printf("Warning : Status 401 has no WWW-Authenticate header\n")
 		}
 	}
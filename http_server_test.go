@@ -124,6 +124,28 @@ func handleForm(request ServerHTTPRequest, response *ServerHTTPResponse) {
 	response.SetHeader("TestHeader", "Hello")
 }
 
+const rangeContent = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+func handleRange(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	response.SetStatus(STATUS_OK)
+	response.SetHeader("Accept-Ranges", "bytes")
+	response.SetHeader("Content-Type", "text/plain")
+	response.SetHeader("ETag", "\"range-v1\"")
+	response.Write([]byte(rangeContent))
+}
+
+var conditionalModified = time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+
+func handleConditional(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	response.SetStatus(STATUS_OK)
+	response.SetETag("dashboard-42", true)
+	response.SetLastModified(conditionalModified)
+	if response.EvaluatePreconditions() {
+		return
+	}
+	response.Write([]byte("Dashboard data\n"))
+}
+
 func setupServer(tb testing.TB) func(tb testing.TB) {
 	server, err := NewHTTPServer(":1234")
 	if err != nil {
@@ -141,9 +163,42 @@ func setupServer(tb testing.TB) func(tb testing.TB) {
 	server.HandlePOST("/large", handleEcho)
 	server.HandleGET("/chunked", handleChunked)
 	server.HandleGET("/cookie", handleCookies)
+	server.HandleGET("/cookie/echo", handleCookieEcho)
+	server.HandleGET("/cookie/expires", handleExpiringCookies)
+	server.HandleGET("/cookie/secret", handleSetSecretCookies)
+	server.HandleGET("/cookie/secret/read", handleReadSecretCookies)
+	server.HandleGET("/session/login", Sessions(testSessionOptions)(handleSessionLogin))
+	server.HandleGET("/session/user", Sessions(testSessionOptions)(handleSessionUser))
+	server.HandleGET("/session/logout", Sessions(testSessionOptions)(handleSessionLogout))
+	server.HandleGET("/auth/basic", BasicAuth("api", testCredentials)(handleAuthenticated))
+	server.HandleGET("/auth/digest", DigestAuth(testDigestOptions)(handleAuthenticated))
+	server.HandleGET("/cookie/cross-site", redirectWithStatus(STATUS_FOUND, "http://127.0.0.1:1234/cookie/echo"))
 	server.HandleGET("/timeout", handleTimeout)
+	server.HandleGET("/range", handleRange)
+	server.HandleGET("/conditional", handleConditional)
+	server.HandlePUT("/conditional", Preconditions(conditionalValidators)(handleConditionalUpdate))
+	server.HandleDELETE("/conditional", handleConditionalUpdate)
+	server.HandleGET("/file", FileServer("go.mod"))
+	server.HandleGET("/trailers", handleTrailers)
+	server.HandlePOST("/trailers", handleTrailerEcho)
+	server.HandlePOSTWithOptions("/extensions", handleTrailerEcho, HandlerOptions{onChunk: handleExtensionChunk, runAfterChunks: true})
+	server.HandleGET("/events", handleEvents)
+	server.HandleGET("/events/endless", handleEndlessEvents)
+	server.HandleWebSocketWithOptions("/websocket", handleWebSocketEcho, WebSocketOptions{Subprotocols: []string{"chat"}})
+	server.HandleWebSocketWithOptions("/websocket/small", handleWebSocketEcho, WebSocketOptions{MaxMessageSize: 32})
+	server.HandleGET("/hijack", handleHijack)
+	server.HandleGET("/upgrade", handleUpgrade)
+	server.HandleCONNECT(handleConnect)
 	server.HandleGET("/redirect", PermaRedirect("http://localhost:1234/path"))
 	server.HandleGET("/infinite/redirect", handleInfiniteRedirect)
+	server.HandlePOST("/redirect/see-other", redirectWithStatus(STATUS_SEE_OTHER, "echo?from=see-other"))
+	server.HandlePOST("/redirect/found", redirectWithStatus(STATUS_FOUND, "echo"))
+	server.HandlePOST("/redirect/temporary", redirectWithStatus(STATUS_TEMPORARY_REDIRECT, "echo?from=temporary"))
+	server.HandleGET("/redirect/nested/relative", redirectWithStatus(STATUS_FOUND, "../echo?from=relative"))
+	server.HandleGET("/redirect/cross-origin", redirectWithStatus(STATUS_FOUND, "http://127.0.0.1:1234/redirect/echo"))
+	server.HandleGET("/redirect/missing", handleMissingLocation)
+	server.HandleGET("/redirect/echo", handleRedirectEcho)
+	server.HandlePOST("/redirect/echo", handleRedirectEcho)
 	server.HandleGET("/testdata/lusiadasTest.txt", FileServerFromPath("testdata"))
 	server.HandleGET("/testdata", FileServer("testdata/lusiadasTest.txt"))
 	server.HandlePOSTWithOptions("/runafter", handleRequest, HandlerOptions{onChunk: handleChunk, runAfterChunks: true})
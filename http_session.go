@@ -0,0 +1,278 @@
+package easyhttp
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"maps"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_SESSION_COOKIE           = "session_id"
+	DEFAULT_SESSION_IDLE_TIMEOUT     = 30 * time.Minute
+	DEFAULT_SESSION_ABSOLUTE_TIMEOUT = 24 * time.Hour
+	// Random bytes in a session id
+	SESSION_ID_LENGTH = 32
+)
+
+// Options used by the Sessions middleware
+type SessionOptions struct {
+	// Keeps the sessions between requests
+	Store SessionStore
+	// Name of the cookie holding the session
+	CookieName string
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   SameSite
+	// Sessions expire after this long without requests. Disabled if zero
+	IdleTimeout time.Duration
+	// Sessions expire this long after they were created, even if they are in use. Disabled if zero
+	AbsoluteTimeout time.Duration
+}
+
+// Returns the session options used by default, with sessions kept in memory and a Secure cookie
+func DefaultSessionOptions() SessionOptions {
+	return SessionOptions{
+		Store:           NewMemorySessionStore(),
+		CookieName:      DEFAULT_SESSION_COOKIE,
+		Path:            "/",
+		Secure:          true,
+		SameSite:        SAME_SITE_LAX,
+		IdleTimeout:     DEFAULT_SESSION_IDLE_TIMEOUT,
+		AbsoluteTimeout: DEFAULT_SESSION_ABSOLUTE_TIMEOUT,
+	}
+}
+
+// Data of a session as kept by a SessionStore
+type SessionRecord struct {
+	ID         string
+	Values     map[string]any
+	Created    time.Time
+	LastAccess time.Time
+}
+
+// Session of the client that sent the request, available to handlers through the Session method of the request
+type Session struct {
+	mutex    sync.Mutex
+	options  *SessionOptions
+	response *ServerHTTPResponse
+	record   SessionRecord
+	// Value of the session cookie, which is the key of the session in the store
+	key       string
+	cookie    *Cookie
+	isNew     bool
+	modified  bool
+	destroyed bool
+}
+
+// Middleware that loads the session of every request from the store and saves it after the handler returns.
+// Handlers that send chunks must call Save before the first chunk, as the session cookie goes on the headers
+func Sessions(options SessionOptions) Middleware {
+	if options.Store == nil {
+		options.Store = NewMemorySessionStore()
+	}
+	if options.CookieName == "" {
+		options.CookieName = DEFAULT_SESSION_COOKIE
+	}
+	return func(next ResponseFunction) ResponseFunction {
+		return func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+			session := loadSession(&options, request, response)
+			request.session = session
+			next(request, response)
+
+			session.mutex.Lock()
+			defer session.mutex.Unlock()
+			// New sessions are only kept once something is stored in them
+			if session.destroyed || session.isNew && !session.modified {
+				return
+			}
+			if err := session.saveLocked(); err != nil {
+				log.Printf("Error saving session: %v\n", err)
+			}
+		}
+	}
+}
+
+func loadSession(options *SessionOptions, request ServerHTTPRequest, response *ServerHTTPResponse) *Session {
+	var now = time.Now()
+	var session = &Session{options: options, response: response}
+	if key, found := request.cookies[options.CookieName]; found {
+		record, err := options.Store.Load(key)
+		if err == nil && !options.expired(record, now) {
+			session.key = key
+			session.record = record
+			if session.record.Values == nil {
+				session.record.Values = make(map[string]any)
+			}
+			return session
+		}
+		if err == nil {
+			options.Store.Delete(key)
+		}
+	}
+	session.isNew = true
+	session.record = SessionRecord{ID: newSessionID(), Values: make(map[string]any), Created: now, LastAccess: now}
+	session.key = session.record.ID
+	return session
+}
+
+func (o *SessionOptions) expired(record SessionRecord, now time.Time) bool {
+	if o.IdleTimeout > 0 && now.Sub(record.LastAccess) >= o.IdleTimeout {
+		return true
+	}
+	return o.AbsoluteTimeout > 0 && now.Sub(record.Created) >= o.AbsoluteTimeout
+}
+
+// Returns when the session expires if it gets no more requests, or the zero time if it never does
+func (o *SessionOptions) expiry(record SessionRecord) time.Time {
+	var expires time.Time
+	if o.IdleTimeout > 0 {
+		expires = record.LastAccess.Add(o.IdleTimeout)
+	}
+	if o.AbsoluteTimeout > 0 {
+		absolute := record.Created.Add(o.AbsoluteTimeout)
+		if expires.IsZero() || absolute.Before(expires) {
+			expires = absolute
+		}
+	}
+	return expires
+}
+
+func newSessionID() string {
+	var id = make([]byte, SESSION_ID_LENGTH)
+	rand.Read(id)
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// Returns the id of the session, which changes when it is regenerated
+func (s *Session) ID() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.record.ID
+}
+
+// Returns when the session was created or last regenerated
+func (s *Session) Created() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.record.Created
+}
+
+// Returns if the session was created by this request
+func (s *Session) IsNew() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.isNew
+}
+
+func (s *Session) Get(key string) (any, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, found := s.record.Values[key]
+	return value, found
+}
+
+func (s *Session) Set(key string, value any) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.record.Values[key] = value
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.record.Values, key)
+	s.modified = true
+}
+
+// Returns a copy of the values of the session
+func (s *Session) Values() map[string]any {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return maps.Clone(s.record.Values)
+}
+
+// Moves the session to a new id, keeping its values, and removes the old one from the store.
+// Must be called when the privileges of the client change, like on login, so a session id planted before can not be used
+func (s *Session) Regenerate() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.isNew {
+		if err := s.options.Store.Delete(s.key); err != nil {
+			return err
+		}
+	}
+	var now = time.Now()
+	s.record.ID = newSessionID()
+	s.record.Created = now
+	s.record.LastAccess = now
+	s.key = s.record.ID
+	s.isNew = true
+	s.modified = true
+	s.destroyed = false
+	return nil
+}
+
+// Removes the session from the store and expires the session cookie
+func (s *Session) Destroy() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.destroyed = true
+	s.record.Values = make(map[string]any)
+	s.setCookie("", -1)
+	if s.isNew {
+		return nil
+	}
+	return s.options.Store.Delete(s.key)
+}
+
+// Saves the session to the store and sets the session cookie. Called by the middleware after the handler returns
+func (s *Session) Save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.saveLocked()
+}
+
+func (s *Session) saveLocked() error {
+	var wasNew = s.isNew
+	s.record.LastAccess = time.Now()
+	key, err := s.options.Store.Save(s.key, s.record, s.options.expiry(s.record))
+	if err != nil {
+		return err
+	}
+	s.isNew = false
+	s.destroyed = false
+	if wasNew || key != s.key {
+		s.key = key
+		s.setCookie(key, 0)
+	}
+	return nil
+}
+
+// Sets the session cookie on the response, replacing the one set before by this request
+func (s *Session) setCookie(value string, maxAge int) {
+	if s.cookie != nil {
+		s.cookie.Value = value
+		s.cookie.MaxAge = maxAge
+		return
+	}
+	cookie := &Cookie{
+		Name:     s.options.CookieName,
+		Value:    value,
+		MaxAge:   maxAge,
+		Path:     s.options.Path,
+		Domain:   s.options.Domain,
+		Secure:   s.options.Secure,
+		HTTPOnly: true,
+		SameSite: s.options.SameSite,
+	}
+	if err := s.response.SetCookie(cookie); err != nil {
+		log.Printf("Error setting session cookie: %v\n", err)
+		return
+	}
+	s.cookie = cookie
+}
@@ -0,0 +1,242 @@
+package easyhttp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keeps sessions between requests. Values are encoded with encoding/gob by stores that serialize them,
+// so custom types stored in a session must be registered with gob.Register
+type SessionStore interface {
+	// Returns the session whose cookie has the key. Returns ErrSessionNotFound if there is none or it expired
+	Load(key string) (SessionRecord, error)
+	// Saves the session until expires, or forever if it is zero, and returns the key set on the session cookie.
+	// Stores keeping sessions on the server return the session id
+	Save(key string, record SessionRecord, expires time.Time) (string, error)
+	// Removes the session
+	Delete(key string) error
+}
+
+type storedSession struct {
+	Record  SessionRecord
+	Expires time.Time
+}
+
+func (s storedSession) expired(now time.Time) bool {
+	return !s.Expires.IsZero() && !now.Before(s.Expires)
+}
+
+// Session store kept in the memory of the server. Safe for concurrent use
+type MemorySessionStore struct {
+	mutex     sync.Mutex
+	sessions  map[string]storedSession
+	lastPrune time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]storedSession), lastPrune: time.Now()}
+}
+
+func (m *MemorySessionStore) Load(key string) (SessionRecord, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	session, found := m.sessions[key]
+	if !found || session.expired(time.Now()) {
+		delete(m.sessions, key)
+		return SessionRecord{}, ErrSessionNotFound
+	}
+	record := session.Record
+	record.Values = maps.Clone(record.Values)
+	return record, nil
+}
+
+func (m *MemorySessionStore) Save(key string, record SessionRecord, expires time.Time) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var now = time.Now()
+	// Expired sessions that are never requested again are removed once a minute
+	if now.Sub(m.lastPrune) > time.Minute {
+		for storedKey, session := range m.sessions {
+			if session.expired(now) {
+				delete(m.sessions, storedKey)
+			}
+		}
+		m.lastPrune = now
+	}
+	record.Values = maps.Clone(record.Values)
+	m.sessions[record.ID] = storedSession{Record: record, Expires: expires}
+	return record.ID, nil
+}
+
+func (m *MemorySessionStore) Delete(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.sessions, key)
+	return nil
+}
+
+// Session store keeping a file per session in a directory
+type FileSessionStore struct {
+	directory string
+}
+
+// Creates the store, creating the directory if it does not exist
+func NewFileSessionStore(directory string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{directory: directory}, nil
+}
+
+// Keys come from the client, so only session ids are turned into file names
+func (f *FileSessionStore) path(key string) (string, bool) {
+	id, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil || len(id) != SESSION_ID_LENGTH {
+		return "", false
+	}
+	return filepath.Join(f.directory, key+".session"), true
+}
+
+func (f *FileSessionStore) Load(key string) (SessionRecord, error) {
+	path, ok := f.path(key)
+	if !ok {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return SessionRecord{}, err
+	}
+	var session storedSession
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&session); err != nil {
+		return SessionRecord{}, err
+	}
+	if session.expired(time.Now()) {
+		os.Remove(path)
+		return SessionRecord{}, ErrSessionNotFound
+	}
+	return session.Record, nil
+}
+
+// Writes the session to a temporary file that replaces the file of the session, so it is never read half written
+func (f *FileSessionStore) Save(key string, record SessionRecord, expires time.Time) (string, error) {
+	path, ok := f.path(record.ID)
+	if !ok {
+		return "", errors.New("bad session id")
+	}
+	var content bytes.Buffer
+	if err := gob.NewEncoder(&content).Encode(storedSession{Record: record, Expires: expires}); err != nil {
+		return "", err
+	}
+	temporary, err := os.CreateTemp(f.directory, ".session.*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(temporary.Name())
+	_, err = temporary.Write(content.Bytes())
+	if closeErr := temporary.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(temporary.Name(), path); err != nil {
+		return "", err
+	}
+	return record.ID, nil
+}
+
+func (f *FileSessionStore) Delete(key string) error {
+	path, ok := f.path(key)
+	if !ok {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Removes the files of expired sessions, which are otherwise only removed when they are requested
+func (f *FileSessionStore) RemoveExpired() error {
+	entries, err := os.ReadDir(f.directory)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		key, found := strings.CutSuffix(entry.Name(), ".session")
+		if !found {
+			continue
+		}
+		if _, err := f.Load(key); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Maximum length of the cookie of a CookieSessionStore, the limit most browsers keep
+const MAX_SESSION_COOKIE_LENGTH = 4096
+
+// Session store that keeps the whole session in the cookie, signed with HMAC-SHA256 so the client can not change it.
+// The first key signs and every key verifies, so keys can be rotated. Sessions can not be revoked before they expire
+type CookieSessionStore struct {
+	keys [][]byte
+}
+
+func NewCookieSessionStore(keys [][]byte) (*CookieSessionStore, error) {
+	if len(keys) == 0 || len(keys[0]) < MIN_SIGNING_KEY_LENGTH {
+		return nil, errors.New("signing key is too short")
+	}
+	return &CookieSessionStore{keys: keys}, nil
+}
+
+// Signed with this name so values signed for other cookies with the same keys are not accepted
+const cookieSessionName = "session"
+
+func (c *CookieSessionStore) Load(key string) (SessionRecord, error) {
+	payload, err := verifyCookieValue(c.keys, cookieSessionName, key)
+	if err != nil {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+	if _, err := openCookiePayload(payload, time.Now()); err != nil {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+	var record SessionRecord
+	if err := gob.NewDecoder(bytes.NewReader(payload[cookieExpiryLength:])).Decode(&record); err != nil {
+		return SessionRecord{}, err
+	}
+	return record, nil
+}
+
+func (c *CookieSessionStore) Save(key string, record SessionRecord, expires time.Time) (string, error) {
+	var content bytes.Buffer
+	if err := gob.NewEncoder(&content).Encode(record); err != nil {
+		return "", err
+	}
+	var expiry int64
+	if !expires.IsZero() {
+		// Rounded up, as the middleware checks the timeouts precisely
+		expiry = expires.Add(time.Second - 1).Unix()
+	}
+	value := signCookieValue(c.keys[0], cookieSessionName, expiringPayload(expiry, content.Bytes()))
+	if len(value) > MAX_SESSION_COOKIE_LENGTH {
+		return "", errors.New("session is too large for a cookie")
+	}
+	return value, nil
+}
+
+// Sessions live in the cookie, so there is nothing to remove
+func (c *CookieSessionStore) Delete(key string) error {
+	return nil
+}
@@ -0,0 +1,235 @@
+package easyhttp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Function that opens a connection to the address on the network, like net.Dialer.DialContext
+type DialFunction func(ctx context.Context, network string, address string) (net.Conn, error)
+
+// Returned, wrapped with the reason, when a SOCKS5 proxy does not open a connection
+var ErrSOCKS5 = errors.New("socks5 proxy error")
+
+const (
+	SOCKS5_VERSION             = 0x05
+	SOCKS5_AUTH_NONE           = 0x00
+	SOCKS5_AUTH_PASSWORD       = 0x02
+	SOCKS5_AUTH_NO_ACCEPTABLE  = 0xFF
+	SOCKS5_PASSWORD_VERSION    = 0x01
+	SOCKS5_COMMAND_CONNECT     = 0x01
+	SOCKS5_ADDRESS_IPV4        = 0x01
+	SOCKS5_ADDRESS_DOMAIN_NAME = 0x03
+	SOCKS5_ADDRESS_IPV6        = 0x04
+)
+
+var socks5ReplyMessages = map[byte]string{
+	0x01: "general failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "ttl expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// Dialer that opens connections through a SOCKS5 proxy as defined by RFC 1928,
+// authenticating with username and password as defined by RFC 1929 when a username is set
+type SOCKS5Dialer struct {
+	// Address of the proxy, like localhost:1080
+	Address  string
+	Username string
+	Password string
+	// Sends host names to the proxy to be resolved there instead of resolving them locally
+	RemoteDNS bool
+	// Opens the connection to the proxy. A net.Dialer is used if nil
+	Forward DialFunction
+}
+
+func NewSOCKS5Dialer(address string) *SOCKS5Dialer {
+	return &SOCKS5Dialer{Address: address}
+}
+
+// Returns a dialer for a socks5 or socks5h proxy uri. socks5h resolves host names on the proxy
+func socks5DialerFromURL(proxyURL *url.URL, forward DialFunction) *SOCKS5Dialer {
+	var address = proxyURL.Host
+	if proxyURL.Port() == "" {
+		address = net.JoinHostPort(proxyURL.Hostname(), "1080")
+	}
+	dialer := NewSOCKS5Dialer(address)
+	dialer.RemoteDNS = proxyURL.Scheme == "socks5h"
+	dialer.Forward = forward
+	if proxyURL.User != nil {
+		dialer.Username = proxyURL.User.Username()
+		dialer.Password, _ = proxyURL.User.Password()
+	}
+	return dialer
+}
+
+// Connects to the address through the proxy. Only tcp networks are supported
+func (d *SOCKS5Dialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("%w: unsupported network %s", ErrSOCKS5, network)
+	}
+	host, portValue, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portValue, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid port %s", ErrSOCKS5, portValue)
+	}
+	if !d.RemoteDNS && net.ParseIP(host) == nil {
+		addresses, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		host = addresses[0].String()
+		for _, resolved := range addresses {
+			if resolved.To4() != nil {
+				host = resolved.String()
+				break
+			}
+		}
+	}
+
+	var forward = d.Forward
+	if forward == nil {
+		forward = (&net.Dialer{}).DialContext
+	}
+	connection, err := forward(ctx, "tcp", d.Address)
+	if err != nil {
+		return nil, err
+	}
+	stopCancel := context.AfterFunc(ctx, func() {
+		connection.SetDeadline(time.Unix(1, 0))
+	})
+	defer stopCancel()
+	if deadline, ok := ctx.Deadline(); ok {
+		connection.SetDeadline(deadline)
+	}
+
+	if err = d.handshake(connection, host, uint16(port)); err != nil {
+		connection.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	connection.SetDeadline(time.Time{})
+	return connection, nil
+}
+
+func (d *SOCKS5Dialer) handshake(connection net.Conn, host string, port uint16) error {
+	var methods = []byte{SOCKS5_AUTH_NONE}
+	if d.Username != "" {
+		methods = []byte{SOCKS5_AUTH_NONE, SOCKS5_AUTH_PASSWORD}
+	}
+	greeting := append([]byte{SOCKS5_VERSION, byte(len(methods))}, methods...)
+	if _, err := connection.Write(greeting); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(connection, reply); err != nil {
+		return err
+	}
+	if reply[0] != SOCKS5_VERSION {
+		return fmt.Errorf("%w: unexpected version %d", ErrSOCKS5, reply[0])
+	}
+	switch reply[1] {
+	case SOCKS5_AUTH_NONE:
+	case SOCKS5_AUTH_PASSWORD:
+		if d.Username == "" {
+			return fmt.Errorf("%w: proxy requires credentials", ErrSOCKS5)
+		}
+		if err := d.authenticate(connection); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: no acceptable authentication method", ErrSOCKS5)
+	}
+
+	request := []byte{SOCKS5_VERSION, SOCKS5_COMMAND_CONNECT, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ipv4 := ip.To4(); ipv4 != nil {
+			request = append(append(request, SOCKS5_ADDRESS_IPV4), ipv4...)
+		} else {
+			request = append(append(request, SOCKS5_ADDRESS_IPV6), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("%w: host name too long", ErrSOCKS5)
+		}
+		request = append(append(request, SOCKS5_ADDRESS_DOMAIN_NAME, byte(len(host))), host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, port)
+	if _, err := connection.Write(request); err != nil {
+		return err
+	}
+	return readSOCKS5Reply(connection)
+}
+
+func (d *SOCKS5Dialer) authenticate(connection net.Conn) error {
+	if len(d.Username) > 255 || len(d.Password) > 255 {
+		return fmt.Errorf("%w: credentials too long", ErrSOCKS5)
+	}
+	request := []byte{SOCKS5_PASSWORD_VERSION, byte(len(d.Username))}
+	request = append(request, d.Username...)
+	request = append(request, byte(len(d.Password)))
+	request = append(request, d.Password...)
+	if _, err := connection.Write(request); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(connection, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0x00 {
+		return fmt.Errorf("%w: authentication failed", ErrSOCKS5)
+	}
+	return nil
+}
+
+// Reads the reply to a connect request, including the bound address the proxy sends
+func readSOCKS5Reply(connection net.Conn) error {
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(connection, reply); err != nil {
+		return err
+	}
+	if reply[0] != SOCKS5_VERSION {
+		return fmt.Errorf("%w: unexpected version %d", ErrSOCKS5, reply[0])
+	}
+	if reply[1] != 0x00 {
+		message, found := socks5ReplyMessages[reply[1]]
+		if !found {
+			message = fmt.Sprintf("unknown reply %d", reply[1])
+		}
+		return fmt.Errorf("%w: %s", ErrSOCKS5, message)
+	}
+
+	var addressLength int
+	switch reply[3] {
+	case SOCKS5_ADDRESS_IPV4:
+		addressLength = net.IPv4len
+	case SOCKS5_ADDRESS_IPV6:
+		addressLength = net.IPv6len
+	case SOCKS5_ADDRESS_DOMAIN_NAME:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(connection, length); err != nil {
+			return err
+		}
+		addressLength = int(length[0])
+	default:
+		return fmt.Errorf("%w: unknown address type %d", ErrSOCKS5, reply[3])
+	}
+	_, err := io.ReadFull(connection, make([]byte, addressLength+2))
+	return err
+}
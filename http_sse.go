@@ -0,0 +1,309 @@
+package easyhttp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event of a Server-Sent Events stream
+type ServerSentEvent struct {
+	// Event type. Events received without a type have the type "message"
+	Event string
+	// Event identifier. Clients send the last identifier received on the Last-Event-ID header when reconnecting
+	ID string
+	// Event data. Data with several lines is sent as several data fields
+	Data string
+	// Reconnection time requested to the client. Not sent if zero
+	Retry time.Duration
+}
+
+func (e ServerSentEvent) toBytes() ([]byte, error) {
+	if strings.ContainsAny(e.Event, "\r\n") {
+		return nil, errors.New("event type cannot contain line breaks")
+	}
+	if strings.ContainsAny(e.ID, "\r\n\x00") {
+		return nil, errors.New("event id cannot contain line breaks or null characters")
+	}
+	buffer := new(bytes.Buffer)
+	if e.Event != "" {
+		buffer.WriteString("event: " + e.Event + "\n")
+	}
+	if e.ID != "" {
+		buffer.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Retry > 0 {
+		buffer.WriteString(fmt.Sprintf("retry: %d\n", e.Retry.Milliseconds()))
+	}
+	if e.Data != "" {
+		for _, line := range splitEventLines(e.Data) {
+			buffer.WriteString("data: " + line + "\n")
+		}
+	}
+	buffer.WriteString("\n")
+	return buffer.Bytes(), nil
+}
+
+func splitEventLines(value string) []string {
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	value = strings.ReplaceAll(value, "\r", "\n")
+	return strings.Split(value, "\n")
+}
+
+// Returns the Last-Event-ID header sent by a reconnecting event stream client or an empty string if there is none
+func (r *ServerHTTPRequest) LastEventID() string {
+	lastEventID := r.GetHeader("Last-Event-ID")
+	if lastEventID == nil {
+		return ""
+	}
+	return joinHeaderValues(lastEventID)
+}
+
+// Starts a Server-Sent Events stream, sending the response headers to the client.
+// A heartbeat comment is sent every heartbeatInterval to keep the connection open. Heartbeats are disabled if it is zero.
+// The request context is cancelled when the client disconnects and the connection is closed once the handler returns
+func (r *ServerHTTPResponse) StartEventStream(heartbeatInterval time.Duration) error {
+	if r.method == MethodHead {
+		return errors.New("head message cannot be an event stream")
+	}
+	r.streamMutex.Lock()
+	defer r.streamMutex.Unlock()
+	if r.eventStream {
+		return errors.New("event stream already started")
+	}
+	if r.chunked {
+		return errors.New("response was already sent")
+	}
+
+	r.SetHeader("Content-Type", "text/event-stream")
+	r.SetHeader("Cache-Control", "no-cache")
+	r.SetHeader("Connection", "close")
+	r.chunked = true
+	r.eventStream = true
+	if err := r.startChunkCompression(); err != nil {
+		return err
+	}
+	responseBytes, err := r.toBytes()
+	if err != nil {
+		return err
+	}
+	if _, err = r.chunkWriter.Write(responseBytes); err != nil {
+		r.closeStreamLocked()
+		return ErrEventStreamClosed
+	}
+	r.body.Reset()
+
+	if r.connection != nil {
+		r.connection.SetReadDeadline(time.Time{})
+		go r.watchDisconnect()
+	}
+	if heartbeatInterval > 0 {
+		go r.sendHeartbeats(heartbeatInterval)
+	}
+	return nil
+}
+
+// Sends an event on the event stream. Returns ErrEventStreamClosed if the client disconnected
+func (r *ServerHTTPResponse) SendEvent(event ServerSentEvent) error {
+	eventBytes, err := event.toBytes()
+	if err != nil {
+		return err
+	}
+	return r.writeStreamData(eventBytes)
+}
+
+// Sends a comment on the event stream. Clients ignore comments, so they are used as heartbeats
+func (r *ServerHTTPResponse) SendComment(comment string) error {
+	buffer := new(bytes.Buffer)
+	for _, line := range splitEventLines(comment) {
+		if line == "" {
+			buffer.WriteString(":\n")
+		} else {
+			buffer.WriteString(": " + line + "\n")
+		}
+	}
+	buffer.WriteString("\n")
+	return r.writeStreamData(buffer.Bytes())
+}
+
+func (r *ServerHTTPResponse) isEventStream() bool {
+	r.streamMutex.Lock()
+	defer r.streamMutex.Unlock()
+	return r.eventStream
+}
+
+func (r *ServerHTTPResponse) writeStreamData(data []byte) error {
+	r.streamMutex.Lock()
+	defer r.streamMutex.Unlock()
+	if !r.eventStream {
+		return errors.New("event stream not started")
+	}
+	if r.streamClosed || r.request.Context().Err() != nil {
+		return ErrEventStreamClosed
+	}
+	if r.compressor != nil {
+		compressedData, err := r.compressor.compress(data)
+		if err != nil {
+			return err
+		}
+		data = compressedData
+	}
+	if err := r.writeChunk(data); err != nil {
+		r.closeStreamLocked()
+		return ErrEventStreamClosed
+	}
+	return nil
+}
+
+func (r *ServerHTTPResponse) closeStreamLocked() {
+	r.streamClosed = true
+	r.request.cancelContext()
+}
+
+// Reads from the connection until it fails, which means the client went away. Clients do not send data on event streams
+func (r *ServerHTTPResponse) watchDisconnect() {
+	buffer := make([]byte, 512)
+	for {
+		var err error
+		if r.reader != nil {
+			_, err = r.reader.Read(buffer)
+		} else {
+			_, err = r.connection.Read(buffer)
+		}
+		if err != nil {
+			r.streamMutex.Lock()
+			r.closeStreamLocked()
+			r.streamMutex.Unlock()
+			return
+		}
+	}
+}
+
+func (r *ServerHTTPResponse) sendHeartbeats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.request.Context().Done():
+			return
+		case <-ticker.C:
+			if err := r.SendComment(""); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Function that handles an event of a Server-Sent Events stream. Returning false stops reading the stream
+type ClientEventFunction func(ServerSentEvent, *ClientHTTPResponse) bool
+
+// Reads the response as a Server-Sent Events stream, running onEvent for every event received.
+// The idle timeout between chunks is disabled, so use SetTimeout to limit how long the stream is read
+func (r *ClientHTTPRequest) OnEventFunction(onEvent ClientEventFunction) {
+	r.SetHeader("Accept", "text/event-stream")
+	r.SetHeader("Cache-Control", "no-cache")
+	r.CloseConnection()
+	r.eventStream = true
+	parser := &eventStreamParser{onEvent: onEvent}
+	r.onResponseChunk = parser.onChunk
+}
+
+// Sets the Last-Event-ID header used to resume an event stream
+func (r *ClientHTTPRequest) SetLastEventID(id string) {
+	r.SetHeader("Last-Event-ID", id)
+}
+
+// Parser of the text/event-stream format that receives the stream one chunk at a time
+type eventStreamParser struct {
+	onEvent     ClientEventFunction
+	buffer      []byte
+	started     bool
+	skipNewline bool
+	eventType   string
+	data        strings.Builder
+	lastEventID string
+	retry       time.Duration
+}
+
+var utf8BOM = []byte("\xEF\xBB\xBF")
+
+func (p *eventStreamParser) onChunk(chunk []byte, response *ClientHTTPResponse) bool {
+	p.buffer = append(p.buffer, chunk...)
+	if !p.started {
+		if len(p.buffer) < len(utf8BOM) && bytes.HasPrefix(utf8BOM, p.buffer) {
+			return true
+		}
+		p.buffer = bytes.TrimPrefix(p.buffer, utf8BOM)
+		p.started = true
+	}
+
+	for {
+		if p.skipNewline && len(p.buffer) > 0 {
+			if p.buffer[0] == '\n' {
+				p.buffer = p.buffer[1:]
+			}
+			p.skipNewline = false
+		}
+		lineEnd := bytes.IndexAny(p.buffer, "\r\n")
+		if lineEnd < 0 {
+			return true
+		}
+		line := string(p.buffer[:lineEnd])
+		if p.buffer[lineEnd] == '\r' {
+			p.skipNewline = true
+		}
+		p.buffer = p.buffer[lineEnd+1:]
+		if !p.processLine(line, response) {
+			return false
+		}
+	}
+}
+
+func (p *eventStreamParser) processLine(line string, response *ClientHTTPResponse) bool {
+	if line == "" {
+		return p.dispatch(response)
+	}
+	if strings.HasPrefix(line, ":") {
+		return true
+	}
+	field, value, _ := strings.Cut(line, ":")
+	value = strings.TrimPrefix(value, " ")
+	switch field {
+	case "event":
+		p.eventType = value
+	case "data":
+		p.data.WriteString(value)
+		p.data.WriteByte('\n')
+	case "id":
+		if !strings.Contains(value, "\x00") {
+			p.lastEventID = value
+		}
+	case "retry":
+		if retry, err := strconv.ParseUint(value, 10, 63); err == nil {
+			p.retry = time.Duration(retry) * time.Millisecond
+		}
+	}
+	return true
+}
+
+func (p *eventStreamParser) dispatch(response *ClientHTTPResponse) bool {
+	if p.data.Len() == 0 {
+		p.eventType = ""
+		return true
+	}
+	event := ServerSentEvent{
+		Event: p.eventType,
+		ID:    p.lastEventID,
+		Data:  strings.TrimSuffix(p.data.String(), "\n"),
+		Retry: p.retry,
+	}
+	if event.Event == "" {
+		event.Event = "message"
+	}
+	p.eventType = ""
+	p.data.Reset()
+	return p.onEvent(event, response)
+}
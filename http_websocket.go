@@ -0,0 +1,627 @@
+package easyhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/textproto"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// GUID appended to the Sec-WebSocket-Key to compute the Sec-WebSocket-Accept header
+const WEBSOCKET_GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Default maximum size of a received WebSocket message in bytes
+const WEBSOCKET_MAX_MESSAGE_SIZE = 1 << 20
+
+// Time to wait for the peer to answer a close frame
+const WEBSOCKET_CLOSE_TIMEOUT = 5 * time.Second
+
+// WebSocket frame opcodes
+const (
+	WEBSOCKET_CONTINUATION_FRAME = 0
+	WEBSOCKET_TEXT_MESSAGE       = 1
+	WEBSOCKET_BINARY_MESSAGE     = 2
+	WEBSOCKET_CLOSE_FRAME        = 8
+	WEBSOCKET_PING_FRAME         = 9
+	WEBSOCKET_PONG_FRAME         = 10
+)
+
+// WebSocket close codes defined in RFC 6455 section 7.4.1
+const (
+	WEBSOCKET_CLOSE_NORMAL              = 1000
+	WEBSOCKET_CLOSE_GOING_AWAY          = 1001
+	WEBSOCKET_CLOSE_PROTOCOL_ERROR      = 1002
+	WEBSOCKET_CLOSE_UNSUPPORTED_DATA    = 1003
+	WEBSOCKET_CLOSE_NO_STATUS           = 1005
+	WEBSOCKET_CLOSE_ABNORMAL            = 1006
+	WEBSOCKET_CLOSE_INVALID_PAYLOAD     = 1007
+	WEBSOCKET_CLOSE_POLICY_VIOLATION    = 1008
+	WEBSOCKET_CLOSE_MESSAGE_TOO_BIG     = 1009
+	WEBSOCKET_CLOSE_MANDATORY_EXTENSION = 1010
+	WEBSOCKET_CLOSE_INTERNAL_ERROR      = 1011
+)
+
+var ErrWebSocketClosed = errors.New("websocket connection closed")
+var ErrWebSocketHandshake = errors.New("websocket handshake failed")
+
+// Error returned when a WebSocket connection is closed by a close frame or a protocol violation
+type WebSocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *WebSocketCloseError) Error() string {
+	return fmt.Sprintf("websocket closed with code %d: %s", e.Code, e.Reason)
+}
+
+type webSocketFrame struct {
+	fin     bool
+	opcode  int
+	payload []byte
+}
+
+// Connection that exchanges WebSocket messages. Reads and writes can run on different goroutines
+type WebSocketConn struct {
+	connection     net.Conn
+	reader         *bufio.Reader
+	client         bool
+	subprotocol    string
+	maxMessageSize int64
+	pongHandler    func([]byte)
+	readMutex      sync.Mutex
+	// Keeps the frames of one message together while control frames can still be sent between them
+	messageMutex sync.Mutex
+	writeMutex   sync.Mutex
+	stateMutex   sync.Mutex
+	closeSent    bool
+}
+
+func newWebSocketConn(connection net.Conn, reader *bufio.Reader, client bool, subprotocol string) *WebSocketConn {
+	if reader == nil {
+		reader = bufio.NewReader(connection)
+	}
+	return &WebSocketConn{
+		connection:     connection,
+		reader:         reader,
+		client:         client,
+		subprotocol:    subprotocol,
+		maxMessageSize: WEBSOCKET_MAX_MESSAGE_SIZE,
+	}
+}
+
+// Returns the subprotocol agreed during the handshake or an empty string if there is none
+func (c *WebSocketConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+func (c *WebSocketConn) RemoteAddr() net.Addr {
+	return c.connection.RemoteAddr()
+}
+
+// Sets the maximum size of a received message. Bigger messages close the connection with WEBSOCKET_CLOSE_MESSAGE_TOO_BIG
+func (c *WebSocketConn) SetMaxMessageSize(size int64) {
+	c.maxMessageSize = size
+}
+
+// Sets the function that runs when a pong frame is received
+func (c *WebSocketConn) SetPongHandler(handler func([]byte)) {
+	c.pongHandler = handler
+}
+
+func (c *WebSocketConn) SetReadDeadline(deadline time.Time) error {
+	return c.connection.SetReadDeadline(deadline)
+}
+
+func (c *WebSocketConn) SetWriteDeadline(deadline time.Time) error {
+	return c.connection.SetWriteDeadline(deadline)
+}
+
+// Reads the next text or binary message, joining fragmented messages. Ping frames are answered automatically.
+// Returns a *WebSocketCloseError when the peer closes the connection or breaks the protocol
+func (c *WebSocketConn) ReadMessage() (int, []byte, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	var messageType = 0
+	message := new(bytes.Buffer)
+	for {
+		frame, err := c.readFrame(c.maxMessageSize - int64(message.Len()))
+		if err != nil {
+			return 0, nil, c.failRead(err)
+		}
+		switch frame.opcode {
+		case WEBSOCKET_PING_FRAME:
+			c.writeFrame(true, WEBSOCKET_PONG_FRAME, frame.payload)
+			continue
+		case WEBSOCKET_PONG_FRAME:
+			if c.pongHandler != nil {
+				c.pongHandler(frame.payload)
+			}
+			continue
+		case WEBSOCKET_CLOSE_FRAME:
+			return 0, nil, c.handleCloseFrame(frame.payload)
+		case WEBSOCKET_CONTINUATION_FRAME:
+			if messageType == 0 {
+				return 0, nil, c.fail(WEBSOCKET_CLOSE_PROTOCOL_ERROR, "continuation frame without a message")
+			}
+		default:
+			if messageType != 0 {
+				return 0, nil, c.fail(WEBSOCKET_CLOSE_PROTOCOL_ERROR, "new message before the previous one finished")
+			}
+			messageType = frame.opcode
+		}
+
+		message.Write(frame.payload)
+		if frame.fin {
+			if messageType == WEBSOCKET_TEXT_MESSAGE && !utf8.Valid(message.Bytes()) {
+				return 0, nil, c.fail(WEBSOCKET_CLOSE_INVALID_PAYLOAD, "text message is not valid utf-8")
+			}
+			return messageType, message.Bytes(), nil
+		}
+	}
+}
+
+// Sends a text or binary message in a single frame
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	return c.WriteFragmentedMessage(messageType, data, len(data))
+}
+
+// Sends a text or binary message split in frames of at most fragmentSize bytes
+func (c *WebSocketConn) WriteFragmentedMessage(messageType int, data []byte, fragmentSize int) error {
+	if messageType != WEBSOCKET_TEXT_MESSAGE && messageType != WEBSOCKET_BINARY_MESSAGE {
+		return errors.New("invalid message type")
+	}
+	if messageType == WEBSOCKET_TEXT_MESSAGE && !utf8.Valid(data) {
+		return errors.New("text message is not valid utf-8")
+	}
+	if fragmentSize <= 0 {
+		fragmentSize = len(data)
+	}
+	c.messageMutex.Lock()
+	defer c.messageMutex.Unlock()
+
+	var opcode = messageType
+	for {
+		fragment := data
+		if len(fragment) > fragmentSize {
+			fragment = data[:fragmentSize]
+		}
+		data = data[len(fragment):]
+		if err := c.writeFrame(len(data) == 0, opcode, fragment); err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		opcode = WEBSOCKET_CONTINUATION_FRAME
+	}
+}
+
+// Sends a ping frame. The payload cannot be bigger than 125 bytes
+func (c *WebSocketConn) Ping(data []byte) error {
+	if len(data) > 125 {
+		return errors.New("control frame payload too big")
+	}
+	return c.writeFrame(true, WEBSOCKET_PING_FRAME, data)
+}
+
+// Starts the closing handshake with the code and reason and closes the connection once the peer answers.
+// Closing an already closed connection does nothing
+func (c *WebSocketConn) Close(code int, reason string) error {
+	if len(reason) > 123 {
+		return errors.New("close reason too long")
+	}
+	c.stateMutex.Lock()
+	if c.closeSent {
+		c.stateMutex.Unlock()
+		return nil
+	}
+	c.closeSent = true
+	c.stateMutex.Unlock()
+
+	err := c.writeFrame(true, WEBSOCKET_CLOSE_FRAME, closePayload(code, reason))
+	c.connection.SetReadDeadline(time.Now().Add(WEBSOCKET_CLOSE_TIMEOUT))
+	// A goroutine blocked on ReadMessage receives the answer and closes the connection itself
+	if c.readMutex.TryLock() {
+		defer c.readMutex.Unlock()
+		for {
+			frame, readErr := c.readFrame(c.maxMessageSize)
+			if readErr != nil || frame.opcode == WEBSOCKET_CLOSE_FRAME {
+				break
+			}
+		}
+		c.connection.Close()
+	}
+	return err
+}
+
+func closePayload(code int, reason string) []byte {
+	if code == 0 || code == WEBSOCKET_CLOSE_NO_STATUS {
+		return nil
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	return append(payload, reason...)
+}
+
+func isValidCloseCode(code int) bool {
+	if code >= 3000 && code <= 4999 {
+		return true
+	}
+	return (code >= 1000 && code <= 1003) || (code >= 1007 && code <= 1014)
+}
+
+func (c *WebSocketConn) handleCloseFrame(payload []byte) error {
+	var code = WEBSOCKET_CLOSE_NO_STATUS
+	var reason string
+	if len(payload) == 1 {
+		return c.fail(WEBSOCKET_CLOSE_PROTOCOL_ERROR, "invalid close frame")
+	}
+	if len(payload) >= 2 {
+		code = int(binary.BigEndian.Uint16(payload))
+		if !isValidCloseCode(code) {
+			return c.fail(WEBSOCKET_CLOSE_PROTOCOL_ERROR, "invalid close code")
+		}
+		if !utf8.Valid(payload[2:]) {
+			return c.fail(WEBSOCKET_CLOSE_INVALID_PAYLOAD, "close reason is not valid utf-8")
+		}
+		reason = string(payload[2:])
+	}
+
+	c.stateMutex.Lock()
+	alreadySent := c.closeSent
+	c.closeSent = true
+	c.stateMutex.Unlock()
+	if !alreadySent {
+		c.writeFrame(true, WEBSOCKET_CLOSE_FRAME, closePayload(code, ""))
+	}
+	c.connection.Close()
+	return &WebSocketCloseError{Code: code, Reason: reason}
+}
+
+// Closes the connection because of a protocol violation, telling the peer why if possible
+func (c *WebSocketConn) fail(code int, reason string) error {
+	c.stateMutex.Lock()
+	alreadySent := c.closeSent
+	c.closeSent = true
+	c.stateMutex.Unlock()
+	if !alreadySent {
+		c.writeFrame(true, WEBSOCKET_CLOSE_FRAME, closePayload(code, reason))
+	}
+	c.connection.Close()
+	return &WebSocketCloseError{Code: code, Reason: reason}
+}
+
+func (c *WebSocketConn) failRead(err error) error {
+	var closeError *WebSocketCloseError
+	if errors.As(err, &closeError) {
+		return c.fail(closeError.Code, closeError.Reason)
+	}
+	c.stateMutex.Lock()
+	closeSent := c.closeSent
+	c.stateMutex.Unlock()
+	c.connection.Close()
+	if closeSent {
+		return ErrWebSocketClosed
+	}
+	return err
+}
+
+func (c *WebSocketConn) readFrame(maxPayload int64) (webSocketFrame, error) {
+	var frame webSocketFrame
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return frame, err
+	}
+	frame.fin = header[0]&0x80 != 0
+	frame.opcode = int(header[0] & 0x0F)
+	if header[0]&0x70 != 0 {
+		return frame, &WebSocketCloseError{Code: WEBSOCKET_CLOSE_PROTOCOL_ERROR, Reason: "reserved bits are set"}
+	}
+	switch frame.opcode {
+	case WEBSOCKET_CONTINUATION_FRAME, WEBSOCKET_TEXT_MESSAGE, WEBSOCKET_BINARY_MESSAGE,
+		WEBSOCKET_CLOSE_FRAME, WEBSOCKET_PING_FRAME, WEBSOCKET_PONG_FRAME:
+	default:
+		return frame, &WebSocketCloseError{Code: WEBSOCKET_CLOSE_PROTOCOL_ERROR, Reason: "unknown opcode"}
+	}
+
+	masked := header[1]&0x80 != 0
+	if masked == c.client {
+		return frame, &WebSocketCloseError{Code: WEBSOCKET_CLOSE_PROTOCOL_ERROR, Reason: "wrong frame masking"}
+	}
+	var length = int64(header[1] & 0x7F)
+	var isControl = frame.opcode >= WEBSOCKET_CLOSE_FRAME
+	if isControl && (!frame.fin || length > 125) {
+		return frame, &WebSocketCloseError{Code: WEBSOCKET_CLOSE_PROTOCOL_ERROR, Reason: "invalid control frame"}
+	}
+	if length == 126 {
+		extendedLength := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, extendedLength); err != nil {
+			return frame, err
+		}
+		length = int64(binary.BigEndian.Uint16(extendedLength))
+	} else if length == 127 {
+		extendedLength := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, extendedLength); err != nil {
+			return frame, err
+		}
+		longLength := binary.BigEndian.Uint64(extendedLength)
+		if longLength>>63 != 0 {
+			return frame, &WebSocketCloseError{Code: WEBSOCKET_CLOSE_PROTOCOL_ERROR, Reason: "invalid frame length"}
+		}
+		length = int64(longLength)
+	}
+	if !isControl && length > maxPayload {
+		return frame, &WebSocketCloseError{Code: WEBSOCKET_CLOSE_MESSAGE_TOO_BIG, Reason: "message too big"}
+	}
+
+	var maskKey [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, maskKey[:]); err != nil {
+			return frame, err
+		}
+	}
+	frame.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, frame.payload); err != nil {
+		return frame, err
+	}
+	if masked {
+		maskPayload(maskKey, frame.payload)
+	}
+	return frame, nil
+}
+
+func maskPayload(maskKey [4]byte, payload []byte) {
+	for i := range payload {
+		payload[i] ^= maskKey[i%4]
+	}
+}
+
+// Writes a single frame. Frames sent by clients are masked with a random key
+func (c *WebSocketConn) writeFrame(fin bool, opcode int, payload []byte) error {
+	c.stateMutex.Lock()
+	closeSent := c.closeSent
+	c.stateMutex.Unlock()
+	if closeSent && opcode != WEBSOCKET_CLOSE_FRAME {
+		return ErrWebSocketClosed
+	}
+
+	buffer := new(bytes.Buffer)
+	var firstByte = byte(opcode)
+	if fin {
+		firstByte |= 0x80
+	}
+	buffer.WriteByte(firstByte)
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	length := len(payload)
+	if length <= 125 {
+		buffer.WriteByte(maskBit | byte(length))
+	} else if length <= 0xFFFF {
+		buffer.WriteByte(maskBit | 126)
+		buffer.Write(binary.BigEndian.AppendUint16(nil, uint16(length)))
+	} else {
+		buffer.WriteByte(maskBit | 127)
+		buffer.Write(binary.BigEndian.AppendUint64(nil, uint64(length)))
+	}
+
+	if c.client {
+		var maskKey [4]byte
+		if _, err := rand.Read(maskKey[:]); err != nil {
+			return err
+		}
+		buffer.Write(maskKey[:])
+		maskedPayload := slices.Clone(payload)
+		maskPayload(maskKey, maskedPayload)
+		buffer.Write(maskedPayload)
+	} else {
+		buffer.Write(payload)
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err := c.connection.Write(buffer.Bytes())
+	return err
+}
+
+// Computes the Sec-WebSocket-Accept value for a Sec-WebSocket-Key
+func webSocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + WEBSOCKET_GUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// Function that handles an accepted WebSocket connection. The connection is closed when it returns
+type WebSocketFunction func(ServerHTTPRequest, *WebSocketConn)
+
+// Additional options for WebSocket handlers
+type WebSocketOptions struct {
+	// Subprotocols supported by the handler in order of preference
+	Subprotocols []string
+	// Maximum size of a received message. WEBSOCKET_MAX_MESSAGE_SIZE is used if zero
+	MaxMessageSize int64
+	// Function that validates the Origin of the handshake. Every origin is accepted if nil
+	CheckOrigin func(ServerHTTPRequest) bool
+}
+
+// Add WebSocket handler to given uri pattern
+func (s *HTTPServer) HandleWebSocket(uriPattern string, handlerFunction WebSocketFunction) {
+	s.HandleWebSocketWithOptions(uriPattern, handlerFunction, WebSocketOptions{})
+}
+
+// Add WebSocket handler to given uri pattern with additional options
+func (s *HTTPServer) HandleWebSocketWithOptions(uriPattern string, handlerFunction WebSocketFunction, options WebSocketOptions) {
+	s.HandleGET(uriPattern, func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+		webSocket, err := acceptWebSocket(request, response, options)
+		if err != nil {
+			return
+		}
+		handlerFunction(request, webSocket)
+		webSocket.Close(WEBSOCKET_CLOSE_NORMAL, "")
+		webSocket.connection.Close()
+	})
+}
+
+// Validates the opening handshake and switches the connection to the WebSocket protocol.
+// On failure the response is left with the error status to send
+func acceptWebSocket(request ServerHTTPRequest, response *ServerHTTPResponse, options WebSocketOptions) (*WebSocketConn, error) {
+	if !headerContainsToken(request.GetHeader("Upgrade"), "websocket") {
+		response.SetStatus(STATUS_UPGRADE_REQUIRED)
+		response.SetHeader("Upgrade", "websocket")
+		response.SetHeader("Connection", "Upgrade")
+		return nil, ErrWebSocketHandshake
+	}
+	if request.version != "1.1" || !headerContainsToken(request.GetHeader("Connection"), "upgrade") {
+		response.SetStatus(STATUS_BAD_REQUEST)
+		return nil, ErrWebSocketHandshake
+	}
+	if !request.HasHeaderValue("Sec-WebSocket-Version", "13") {
+		response.SetStatus(STATUS_UPGRADE_REQUIRED)
+		response.SetHeader("Sec-WebSocket-Version", "13")
+		return nil, ErrWebSocketHandshake
+	}
+	keyHeader := request.GetHeader("Sec-WebSocket-Key")
+	if len(keyHeader) != 1 {
+		response.SetStatus(STATUS_BAD_REQUEST)
+		return nil, ErrWebSocketHandshake
+	}
+	key := strings.TrimSpace(keyHeader[0])
+	if decodedKey, err := base64.StdEncoding.DecodeString(key); err != nil || len(decodedKey) != 16 {
+		response.SetStatus(STATUS_BAD_REQUEST)
+		return nil, ErrWebSocketHandshake
+	}
+	if options.CheckOrigin != nil && !options.CheckOrigin(request) {
+		response.SetStatus(STATUS_FORBIDDEN)
+		return nil, ErrWebSocketHandshake
+	}
+
+	var subprotocol string
+	requestedProtocols := request.GetHeader("Sec-WebSocket-Protocol")
+	for _, protocol := range options.Subprotocols {
+		if slices.Contains(requestedProtocols, protocol) {
+			subprotocol = protocol
+			break
+		}
+	}
+
+	response.SetHeader("Sec-WebSocket-Accept", webSocketAccept(key))
+	if subprotocol != "" {
+		response.SetHeader("Sec-WebSocket-Protocol", subprotocol)
+	}
+	connection, reader, err := response.Upgrade("websocket")
+	if err != nil {
+		return nil, err
+	}
+	webSocket := newWebSocketConn(connection, reader, false, subprotocol)
+	if options.MaxMessageSize > 0 {
+		webSocket.maxMessageSize = options.MaxMessageSize
+	}
+	return webSocket, nil
+}
+
+// Opens a WebSocket connection to the request uri, which can use the ws, wss, http or https schemes.
+// Subprotocols can be requested with the Sec-WebSocket-Protocol header. If the server refuses the upgrade,
+// its response is returned with ErrWebSocketHandshake
+func (c *httpClient) DialWebSocket(request ClientHTTPRequest) (*WebSocketConn, *ClientHTTPResponse, error) {
+	uri := *request.uri
+	switch uri.Scheme {
+	case "ws", "http":
+		uri.Scheme = "http"
+	case "wss", "https":
+		uri.Scheme = "https"
+	default:
+		return nil, nil, errors.New("websocket uri must use the ws or wss scheme")
+	}
+	if uri.Host == "" {
+		return nil, nil, errors.New("websocket uri must be absolute")
+	}
+
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	request.method = MethodGet
+	// The handshake headers go into a copy so the caller's request can be dialed again
+	request.headers = maps.Clone(request.headers)
+	request.SetHeader("Host", uri.Host)
+	request.SetHeader("Upgrade", "websocket")
+	request.SetHeader("Connection", "Upgrade")
+	request.SetHeader("Sec-WebSocket-Key", key)
+	request.SetHeader("Sec-WebSocket-Version", "13")
+	request.cookies = c.jarCookies(&uri, nil, MethodGet)
+
+	proxyURL, err := c.proxyFor(&uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Plain websockets are tunnelled through proxies too, so the dial uses the websocket scheme
+	dialURI := uri
+	dialURI.Scheme = strings.Replace(uri.Scheme, "http", "ws", 1)
+	connection, err := c.dialContext(context.Background(), &dialURI, proxyURL, time.Time{})
+	if err != nil {
+		return nil, nil, err
+	}
+	if request.timeout > 0 {
+		connection.SetDeadline(time.Now().Add(request.timeout))
+	} else {
+		connection.SetDeadline(time.Now().Add(KEEP_ALIVE_TIMEOUT * time.Second))
+	}
+	requestBytes, err := request.toBytes()
+	if err != nil {
+		connection.Close()
+		return nil, nil, err
+	}
+	if _, err = connection.Write(requestBytes); err != nil {
+		connection.Close()
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(connection)
+	responseReader := textproto.NewReader(reader)
+	response, err := parseResponsefromConnection(responseReader)
+	if err != nil {
+		connection.Close()
+		return nil, nil, err
+	}
+	c.storeCookies(&uri, response.Cookies())
+
+	if response.StatusCode != STATUS_SWITCHING_PROTOCOL {
+		parseResponseBody(response, connection, responseReader, nil, responseDeadlines{idleTimeout: KEEP_ALIVE_TIMEOUT * time.Second})
+		connection.Close()
+		return nil, response, ErrWebSocketHandshake
+	}
+	acceptHeader := response.GetHeader("Sec-WebSocket-Accept")
+	if !headerContainsToken(response.GetHeader("Upgrade"), "websocket") ||
+		!headerContainsToken(response.GetHeader("Connection"), "upgrade") ||
+		len(acceptHeader) != 1 || acceptHeader[0] != webSocketAccept(key) {
+		connection.Close()
+		return nil, response, ErrWebSocketHandshake
+	}
+	var subprotocol string
+	if protocolHeader := response.GetHeader("Sec-WebSocket-Protocol"); protocolHeader != nil {
+		subprotocol = protocolHeader[0]
+		if len(protocolHeader) != 1 || !slices.Contains(request.GetHeader("Sec-WebSocket-Protocol"), subprotocol) {
+			connection.Close()
+			return nil, response, ErrWebSocketHandshake
+		}
+	}
+
+	connection.SetDeadline(time.Time{})
+	return newWebSocketConn(connection, reader, true, subprotocol), response, nil
+}
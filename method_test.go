@@ -1,6 +1,9 @@
 package easyhttp
 
 import (
+	"bufio"
+	"context"
+	"net"
 	"testing"
 )
 
@@ -67,3 +70,106 @@ func TestMethods(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+type SetMethodTest struct {
+	method        string
+	expectedError bool
+}
+
+var setMethodTests = []SetMethodTest{
+	{method: "GET"},
+	{method: "OPTIONS"},
+	{method: "PROPFIND"},
+	{method: "X-CUSTOM.METHOD"},
+	{method: "", expectedError: true},
+	{method: "GE T", expectedError: true},
+	{method: "GET\r\n", expectedError: true},
+	{method: "GET(", expectedError: true},
+}
+
+func TestSetMethod(t *testing.T) {
+	for _, test := range setMethodTests {
+		request, err := NewRequest("http://localhost:1234/path")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		err = request.SetMethod(test.method)
+		if (err != nil) != test.expectedError {
+			t.Errorf("Test failed. Method: %q; Expected error: %v; Got: %v\n", test.method, test.expectedError, err)
+			continue
+		}
+		if !test.expectedError && request.Method() != test.method {
+			t.Errorf("Test failed. Method: %q; Got: %q\n", test.method, request.Method())
+		}
+	}
+}
+
+func TestDoCustomMethod(t *testing.T) {
+	listener, err := net.Listen("tcp", ":1234")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+	requestLines := make(chan string, 1)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer connection.Close()
+		requestLine, _ := bufio.NewReader(connection).ReadString('\n')
+		requestLines <- requestLine
+		connection.Write([]byte("HTTP/1.1 204 No Content\r\nConnection: close\r\n\r\n"))
+	}()
+
+	client := NewHTTPClient()
+	request, err := NewRequest("http://localhost:1234/collection")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = request.SetMethod("PROPFIND"); err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.Do(context.Background(), request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_NO_CONTENT {
+		t.Fatalf("Wrong status %d\n", response.StatusCode)
+	}
+	if requestLine := <-requestLines; requestLine != "PROPFIND /collection HTTP/1.1\r\n" {
+		t.Fatalf("Wrong request line %q\n", requestLine)
+	}
+}
+
+func TestDoInvalidMethod(t *testing.T) {
+	client := NewHTTPClient()
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.method = "BAD METHOD"
+	_, err = client.Do(context.Background(), request)
+	if err != ErrInvalidMethod {
+		t.Fatalf("Got wrong error %v\n", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.CloseConnection()
+	response, err := client.OPTIONS(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_METHOD_NOT_ALLOWED {
+		t.Fatalf("Wrong status %d\n", response.StatusCode)
+	}
+}
@@ -0,0 +1,90 @@
+package easyhttp
+
+import (
+	"net/http"
+	"testing"
+)
+
+type MimeLookupTest struct {
+	extension    string
+	expectedType string
+}
+
+var mimeLookupTests = []MimeLookupTest{
+	{extension: "html", expectedType: "text/html; charset=utf-8"},
+	{extension: ".CSV", expectedType: "text/csv; charset=utf-8"},
+	{extension: "WASM", expectedType: "application/wasm"},
+	{extension: ".woff2", expectedType: "font/woff2"},
+	{extension: "webp", expectedType: "image/webp"},
+	{extension: "Mp4", expectedType: "video/mp4"},
+	{extension: "js", expectedType: "application/javascript"},
+	{extension: "xml", expectedType: "application/xml"},
+	{extension: "json", expectedType: "application/json"},
+	{extension: "unknownext", expectedType: ""},
+	{extension: "", expectedType: ""},
+}
+
+func TestMimeTypeByExtension(t *testing.T) {
+	for _, test := range mimeLookupTests {
+		got := MimeTypeByExtension(test.extension)
+		if got != test.expectedType {
+			t.Errorf("Test failed. Extension: %s; Expected: %s; Got: %s\n", test.extension, test.expectedType, got)
+		}
+	}
+}
+
+func TestRegisterMimeType(t *testing.T) {
+	if err := RegisterMimeType(".GEOJSON", "application/geo+json"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if got := MimeTypeByExtension("geojson"); got != "application/geo+json" {
+		t.Fatalf("Wrong mime type %s", got)
+	}
+	if err := RegisterMimeType("", "text/plain"); err == nil {
+		t.Fatalf("Empty extension should fail")
+	}
+	if err := RegisterMimeType("bad", "plain"); err == nil {
+		t.Fatalf("Invalid mime type should fail")
+	}
+}
+
+type SniffTest struct {
+	data         []byte
+	expectedType string
+}
+
+var sniffTests = []SniffTest{
+	{data: []byte("\x89PNG\r\n\x1A\n\x00\x00\x00\x0DIHDR"), expectedType: "image/png"},
+	{data: []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), expectedType: "image/webp"},
+	{data: []byte("\x00asm\x01\x00\x00\x00"), expectedType: "application/wasm"},
+	{data: []byte("wOF2\x00\x01\x00\x00"), expectedType: "font/woff2"},
+	{data: []byte("\x00\x00\x00\x18ftypmp42"), expectedType: "video/mp4"},
+	{data: []byte("%PDF-1.7\n"), expectedType: "application/pdf"},
+	{data: []byte("  <!doctype html><html></html>"), expectedType: "text/html; charset=utf-8"},
+	{data: []byte("<?xml version=\"1.0\"?><a/>"), expectedType: "text/xml; charset=utf-8"},
+	{data: []byte("name,value\na,1\n"), expectedType: "text/plain; charset=utf-8"},
+	{data: []byte{0x01, 0x02, 0x03, 0x04}, expectedType: "application/octet-stream"},
+}
+
+func TestDetectContentType(t *testing.T) {
+	for _, test := range sniffTests {
+		got := DetectContentType(test.data)
+		if got != test.expectedType {
+			t.Errorf("Test failed. Data: %q; Expected: %s; Got: %s\n", test.data, test.expectedType, got)
+		}
+	}
+}
+
+func TestFileServerSniffedContentType(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	response, err := http.Get("http://localhost:1234/file")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response.Body.Close()
+	if response.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Fatalf("Wrong content type %s", response.Header.Get("Content-Type"))
+	}
+}
@@ -0,0 +1,238 @@
+package easyhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Starts a server that answers every request with responseBytes and closes the connection right after
+func setupClosingServer(tb testing.TB, responseBytes string) func(tb testing.TB) {
+	listener, err := net.Listen("tcp", ":1234")
+	if err != nil {
+		tb.Fatalf("Error creating listener")
+	}
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer connection.Close()
+				if _, err := http.ReadRequest(bufio.NewReader(connection)); err == nil {
+					connection.Write([]byte(responseBytes))
+				}
+			}()
+		}
+	}()
+	return func(tb testing.TB) {
+		listener.Close()
+	}
+}
+
+func idleConnections(client *httpClient, uri string) int {
+	request, _ := NewRequest(uri)
+	client.pool.mutex.Lock()
+	defer client.pool.mutex.Unlock()
+	return len(client.pool.idle[poolKey(request.uri)])
+}
+
+func waitForIdleConnections(client *httpClient, uri string, expected int) bool {
+	for i := 0; i < 100; i++ {
+		if idleConnections(client, uri) == expected {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestPoolReusesConnection(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	var connections []*pooledConnection
+	for i := 0; i < 3; i++ {
+		request, err := NewRequest("http://localhost:1234/path")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		response, err := client.GET(request)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if response.StatusCode != STATUS_OK {
+			t.Fatalf("Wrong status %d", response.StatusCode)
+		}
+		client.pool.mutex.Lock()
+		connections = append(connections, client.pool.idle["http://localhost:1234"]...)
+		client.pool.mutex.Unlock()
+	}
+	if len(connections) != 3 || connections[0] != connections[1] || connections[1] != connections[2] {
+		t.Fatalf("Connection was not reused %v", connections)
+	}
+}
+
+func TestConcurrentClientRequests(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+	client.MaxConnsPerHost = 2
+
+	var waitGroup sync.WaitGroup
+	var errors = make(chan string, 100)
+	for i := 0; i < 20; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for j := 0; j < 5; j++ {
+				request, err := NewRequest("http://localhost:1234/path")
+				if err != nil {
+					errors <- err.Error()
+					return
+				}
+				response, err := client.GET(request)
+				if err != nil {
+					errors <- err.Error()
+					return
+				}
+				body, _ := io.ReadAll(response.GetBody())
+				if response.StatusCode != STATUS_OK || string(body) != "Hello World!\n" {
+					errors <- "wrong response " + string(body)
+				}
+				client.pool.mutex.Lock()
+				open := client.pool.open["http://localhost:1234"]
+				client.pool.mutex.Unlock()
+				if open > 2 {
+					errors <- "too many open connections"
+				}
+			}
+		}()
+	}
+	waitGroup.Wait()
+	close(errors)
+	for err := range errors {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedRequestAcrossGoroutines(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var waitGroup sync.WaitGroup
+	var errors = make(chan string, 10)
+	for i := 0; i < 10; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			response, err := client.GET(request)
+			if err != nil {
+				errors <- err.Error()
+				return
+			}
+			if response.StatusCode != STATUS_OK {
+				errors <- "wrong response status"
+			}
+		}()
+	}
+	waitGroup.Wait()
+	close(errors)
+	for err := range errors {
+		t.Fatal(err)
+	}
+	if request.GetHeader("Host") != nil {
+		t.Fatalf("Client added headers to the caller's request")
+	}
+}
+
+func TestPoolDropsConnectionClosedByServer(t *testing.T) {
+	tearDown := setupClosingServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	for i := 0; i < 2; i++ {
+		request, err := NewRequest("http://localhost:1234/")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		response, err := client.GET(request)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		body, _ := io.ReadAll(response.GetBody())
+		if string(body) != "ok" {
+			t.Fatalf("Wrong body %s", body)
+		}
+		if !waitForIdleConnections(&client, "http://localhost:1234/", 0) {
+			t.Fatalf("Closed connection was kept in the pool")
+		}
+	}
+}
+
+func TestPoolHonoursConnectionClose(t *testing.T) {
+	tearDown := setupClosingServer(t, "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 2\r\n\r\nok")
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err = client.GET(request); err != nil {
+		t.Fatal(err.Error())
+	}
+	if idleConnections(&client, "http://localhost:1234/") != 0 {
+		t.Fatalf("Connection was pooled after Connection: close")
+	}
+}
+
+func TestPoolExpiresConnections(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+	client.IdleConnTimeout = 50 * time.Millisecond
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err = client.GET(request); err != nil {
+		t.Fatal(err.Error())
+	}
+	if idleConnections(&client, "http://localhost:1234/path") != 1 {
+		t.Fatalf("Connection was not pooled")
+	}
+	if !waitForIdleConnections(&client, "http://localhost:1234/path", 0) {
+		t.Fatalf("Idle connection did not expire")
+	}
+
+	client.IdleConnTimeout = 0
+	client.MaxConnLifetime = time.Nanosecond
+	if _, err = client.GET(request); err != nil {
+		t.Fatal(err.Error())
+	}
+	if idleConnections(&client, "http://localhost:1234/path") != 0 {
+		t.Fatalf("Connection was kept after its lifetime")
+	}
+
+	client.MaxConnLifetime = 0
+	if _, err = client.GET(request); err != nil {
+		t.Fatal(err.Error())
+	}
+	client.CloseIdleConnections()
+	if idleConnections(&client, "http://localhost:1234/path") != 0 {
+		t.Fatalf("Idle connections were not closed")
+	}
+}
@@ -0,0 +1,155 @@
+package easyhttp
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+type RangeParseTest struct {
+	header         string
+	size           int64
+	expectedRanges []byteRange
+	expectedError  error
+}
+
+var rangeParseTests = []RangeParseTest{
+	{header: "bytes=0-4", size: 10, expectedRanges: []byteRange{{start: 0, length: 5}}},
+	{header: "bytes=5-", size: 10, expectedRanges: []byteRange{{start: 5, length: 5}}},
+	{header: "bytes=-3", size: 10, expectedRanges: []byteRange{{start: 7, length: 3}}},
+	{header: "bytes=-30", size: 10, expectedRanges: []byteRange{{start: 0, length: 10}}},
+	{header: "bytes=8-20", size: 10, expectedRanges: []byteRange{{start: 8, length: 2}}},
+	{header: "bytes=0-1, 4-5", size: 10, expectedRanges: []byteRange{{start: 0, length: 2}, {start: 4, length: 2}}},
+	{header: "bytes=20-30", size: 10, expectedError: ErrRangeNotSatisfiable},
+	{header: "bytes=5-2", size: 10, expectedError: errInvalidRange},
+	{header: "items=0-2", size: 10, expectedError: errInvalidRange},
+	{header: "bytes=a-b", size: 10, expectedError: errInvalidRange},
+}
+
+func TestRangeParsing(t *testing.T) {
+	for _, test := range rangeParseTests {
+		ranges, err := parseRangeHeader(test.header, test.size)
+		if err != test.expectedError {
+			t.Errorf("Test failed. Header: %s; Expected error: %v; Got: %v\n", test.header, test.expectedError, err)
+			continue
+		}
+		if len(ranges) != len(test.expectedRanges) {
+			t.Errorf("Test failed. Header: %s; Expected: %v; Got: %v\n", test.header, test.expectedRanges, ranges)
+			continue
+		}
+		for i, expectedRange := range test.expectedRanges {
+			if ranges[i] != expectedRange {
+				t.Errorf("Test failed. Header: %s; Expected: %v; Got: %v\n", test.header, test.expectedRanges, ranges)
+			}
+		}
+	}
+}
+
+func TestSingleRangeRequest(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/range")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetHeader("Range", "bytes=10-15")
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if response.StatusCode != STATUS_PARTIAL_CONTENT {
+		t.Fatalf("Got wrong STATUS %d\n", response.StatusCode)
+	}
+	if !response.HasHeaderValue("Content-Range", "bytes 10-15/36") || !response.HasHeaderValue("Accept-Ranges", "bytes") {
+		t.Fatalf("Wrong range headers")
+	}
+	body, _ := io.ReadAll(response.GetBody())
+	if string(body) != "abcdef" {
+		t.Fatalf("Wrong body %s", body)
+	}
+
+	request, err = NewRequest("http://localhost:1234/range")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.CloseConnection()
+	request.SetHeader("Range", "bytes=100-")
+	response, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_RANGE_NOT_SATISFIABLE || !response.HasHeaderValue("Content-Range", "bytes */36") {
+		t.Fatalf("Got wrong STATUS %d\n", response.StatusCode)
+	}
+}
+
+func TestMultipleRangeRequest(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/range")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.CloseConnection()
+	request.SetHeader("Range", "bytes=0-2,-3")
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if response.StatusCode != STATUS_PARTIAL_CONTENT {
+		t.Fatalf("Got wrong STATUS %d\n", response.StatusCode)
+	}
+	contentType := response.GetHeader("Content-Type")
+	if contentType == nil || !strings.HasPrefix(contentType[0], "multipart/byteranges; boundary=") {
+		t.Fatalf("Wrong content type")
+	}
+	body, _ := io.ReadAll(response.GetBody())
+	if !strings.Contains(string(body), "Content-Range: bytes 0-2/36\r\n\r\n012\r\n") || !strings.Contains(string(body), "Content-Range: bytes 33-35/36\r\n\r\nxyz\r\n") {
+		t.Fatalf("Wrong multipart body %s", body)
+	}
+}
+
+func TestIfRangeRequest(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/range")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetHeader("Range", "bytes=0-2")
+	request.SetHeader("If-Range", "\"range-v1\"")
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_PARTIAL_CONTENT {
+		t.Fatalf("Got wrong STATUS %d\n", response.StatusCode)
+	}
+
+	request, err = NewRequest("http://localhost:1234/range")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.CloseConnection()
+	request.SetHeader("Range", "bytes=0-2")
+	request.SetHeader("If-Range", "\"range-v0\"")
+	response, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_OK {
+		t.Fatalf("Got wrong STATUS %d\n", response.StatusCode)
+	}
+	body, _ := io.ReadAll(response.GetBody())
+	if string(body) != rangeContent {
+		t.Fatalf("Wrong body %s", body)
+	}
+}
@@ -1,6 +1,32 @@
 package easyhttp
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func redirectWithStatus(status int, location string) ResponseFunction {
+	return func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+		response.SetStatus(status)
+		response.SetHeader("Location", location)
+	}
+}
+
+func handleMissingLocation(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	response.SetStatus(STATUS_FOUND)
+}
+
+func handleRedirectEcho(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	response.SetStatus(STATUS_OK)
+	response.SetHeader("Received-Method", request.method)
+	response.SetHeader("Received-Query", request.uri.RawQuery)
+	if authorization := request.GetHeader("Authorization"); authorization != nil {
+		response.SetHeader("Received-Authorization", authorization[0])
+	}
+	response.Write(request.Body)
+}
 
 func TestRedirects(t *testing.T) {
 	tearDown := setupServer(t)
@@ -48,3 +74,141 @@ func TestInfiniteRedirects(t *testing.T) {
 		t.Fatal("Test should fail because to many redirects")
 	}
 }
+
+type RedirectMethodTest struct {
+	path           string
+	method         string
+	expectedMethod string
+	expectedQuery  string
+	expectedBody   string
+}
+
+var redirectMethodTests = []RedirectMethodTest{
+	{path: "/redirect/see-other", method: MethodPost, expectedMethod: MethodGet, expectedQuery: "from=see-other"},
+	{path: "/redirect/found", method: MethodPost, expectedMethod: MethodGet},
+	{path: "/redirect/temporary", method: MethodPost, expectedMethod: MethodPost, expectedQuery: "from=temporary", expectedBody: "request body"},
+	{path: "/redirect/nested/relative", method: MethodGet, expectedMethod: MethodGet, expectedQuery: "from=relative"},
+}
+
+func TestRedirectMethodAndBody(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	for _, test := range redirectMethodTests {
+		request, err := NewRequest("http://localhost:1234" + test.path)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		request.SetMethod(test.method)
+		if test.method == MethodPost {
+			request.SetBody([]byte("request body"))
+		}
+		response, err := client.Do(context.Background(), request)
+		if err != nil {
+			t.Errorf("Test failed. Path: %s; Got error: %v\n", test.path, err)
+			continue
+		}
+		body, _ := io.ReadAll(response)
+		if response.StatusCode != STATUS_OK || !response.HasHeaderValue("Received-Method", test.expectedMethod) ||
+			!response.HasHeaderValue("Received-Query", test.expectedQuery) || string(body) != test.expectedBody {
+			t.Errorf("Test failed. Path: %s; Got status %d, headers %v and body %q\n", test.path, response.StatusCode, response.Headers(), body)
+		}
+	}
+}
+
+func TestRedirectStripsCredentialsAcrossOrigins(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/redirect/nested/relative")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetHeader("Authorization", "Bearer secret")
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !response.HasHeaderValue("Received-Authorization", "Bearer secret") {
+		t.Fatalf("Credentials were not kept on a same origin redirect")
+	}
+
+	request, err = NewRequest("http://localhost:1234/redirect/cross-origin")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetHeader("Authorization", "Bearer secret")
+	response, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_OK || response.ExistsHeader("Received-Authorization") {
+		t.Fatalf("Credentials were sent to another origin")
+	}
+	if request.GetHeader("Authorization") == nil {
+		t.Fatalf("Headers of the original request were changed")
+	}
+}
+
+func TestRedirectWithoutLocation(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/redirect/missing")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_FOUND {
+		t.Fatalf("Wrong status %d\n", response.StatusCode)
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	var chain []string
+	client.CheckRedirect = func(request ClientHTTPRequest, via []ClientHTTPRequest) error {
+		chain = append(chain, via[len(via)-1].uri.Path+" -> "+request.uri.Path)
+		return ErrUseLastResponse
+	}
+	request, err := NewRequest("http://localhost:1234/redirect")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_MOVED_PERMANENTLY || len(chain) != 1 || chain[0] != "/redirect -> /path" {
+		t.Fatalf("Wrong response %d with chain %v\n", response.StatusCode, chain)
+	}
+
+	stopError := errors.New("redirect not allowed")
+	client.CheckRedirect = func(request ClientHTTPRequest, via []ClientHTTPRequest) error {
+		return stopError
+	}
+	_, err = client.GET(request)
+	if err != stopError {
+		t.Fatalf("Got wrong error %v\n", err)
+	}
+}
+
+func TestIsRedirected(t *testing.T) {
+	for _, status := range []int{STATUS_MULTIPLE_CHOICES, STATUS_MOVED_PERMANENTLY, STATUS_FOUND, STATUS_SEE_OTHER, STATUS_NOT_MODIFIED, STATUS_TEMPORARY_REDIRECT, STATUS_PERMANENT_REDIRECT} {
+		response := &ClientHTTPResponse{StatusCode: status, headers: make(Headers)}
+		response.SetHeader("Location", "/path")
+		var expected = status != STATUS_MULTIPLE_CHOICES && status != STATUS_NOT_MODIFIED
+		if isRedirected(response) != expected {
+			t.Errorf("Test failed. Status: %d; Expected: %v\n", status, expected)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package easyhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server on :1234 that answers the requests it receives, over any connection, with the responses in order.
+// An empty response closes the connection without answering
+type scriptedServer struct {
+	mutex     sync.Mutex
+	responses []string
+	bodies    []string
+}
+
+func setupScriptedServer(tb testing.TB, responses ...string) (*scriptedServer, func(tb testing.TB)) {
+	listener, err := net.Listen("tcp", ":1234")
+	if err != nil {
+		tb.Fatalf("Error creating listener")
+	}
+	server := &scriptedServer{responses: responses}
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(connection)
+		}
+	}()
+	return server, func(tb testing.TB) {
+		listener.Close()
+	}
+}
+
+func (s *scriptedServer) serve(connection net.Conn) {
+	defer connection.Close()
+	reader := bufio.NewReader(connection)
+	for {
+		request, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		body, _ := io.ReadAll(request.Body)
+		s.mutex.Lock()
+		s.bodies = append(s.bodies, string(body))
+		var response string
+		if len(s.bodies) <= len(s.responses) {
+			response = s.responses[len(s.bodies)-1]
+		}
+		s.mutex.Unlock()
+		if response == "" {
+			return
+		}
+		connection.Write([]byte(response))
+	}
+}
+
+func (s *scriptedServer) requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.bodies
+}
+
+const okResponse = "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"
+const unavailableResponse = "HTTP/1.1 503 Service Unavailable\r\nContent-Length: 0\r\n\r\n"
+
+func retryingClient() httpClient {
+	client := NewHTTPClient()
+	client.Retry = NewRetryPolicy()
+	client.Retry.BaseDelay = time.Millisecond
+	return client
+}
+
+func TestRetryOnRetryableStatus(t *testing.T) {
+	server, tearDown := setupScriptedServer(t, "HTTP/1.1 503 Service Unavailable\r\nRetry-After: 0\r\nContent-Length: 0\r\n\r\n", unavailableResponse, okResponse)
+	defer tearDown(t)
+	client := retryingClient()
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_OK || len(server.requests()) != 3 {
+		t.Fatalf("Got status %d after %d attempts\n", response.StatusCode, len(server.requests()))
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	server, tearDown := setupScriptedServer(t, unavailableResponse, unavailableResponse, unavailableResponse, okResponse)
+	defer tearDown(t)
+	client := retryingClient()
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_SERVICE_UNAVAILABLE || len(server.requests()) != DEFAULT_RETRY_ATTEMPTS {
+		t.Fatalf("Got status %d after %d attempts\n", response.StatusCode, len(server.requests()))
+	}
+}
+
+func TestRetryAfterLongerThanMaxDelay(t *testing.T) {
+	server, tearDown := setupScriptedServer(t, "HTTP/1.1 429 Too Many Requests\r\nRetry-After: 120\r\nContent-Length: 0\r\n\r\n", okResponse)
+	defer tearDown(t)
+	client := retryingClient()
+	client.Retry.MaxDelay = time.Second
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_TOO_MANY_REQUESTS || len(server.requests()) != 1 {
+		t.Fatalf("Got status %d after %d attempts\n", response.StatusCode, len(server.requests()))
+	}
+}
+
+func TestRetryOnlyIdempotentRequests(t *testing.T) {
+	server, tearDown := setupScriptedServer(t, unavailableResponse, unavailableResponse, okResponse)
+	defer tearDown(t)
+	client := retryingClient()
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetBody([]byte("payload"))
+	response, err := client.POST(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_SERVICE_UNAVAILABLE || len(server.requests()) != 1 {
+		t.Fatalf("Non idempotent request was retried")
+	}
+
+	request.SetHeader("Idempotency-Key", "8e03978e")
+	response, err = client.POST(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	bodies := server.requests()
+	if response.StatusCode != STATUS_OK || len(bodies) != 3 || bodies[1] != "payload" || bodies[2] != "payload" {
+		t.Fatalf("Got status %d with bodies %v\n", response.StatusCode, bodies)
+	}
+}
+
+func TestRetryReplaysBodyReader(t *testing.T) {
+	server, tearDown := setupScriptedServer(t, unavailableResponse, okResponse)
+	defer tearDown(t)
+	client := retryingClient()
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	bodyReader := strings.NewReader("skipped:payload")
+	bodyReader.Seek(int64(len("skipped:")), io.SeekStart)
+	request.SetBodyReader(bodyReader, -1)
+	response, err := client.PUT(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	bodies := server.requests()
+	if response.StatusCode != STATUS_OK || len(bodies) != 2 || bodies[0] != "payload" || bodies[1] != "payload" {
+		t.Fatalf("Got status %d with bodies %v\n", response.StatusCode, bodies)
+	}
+}
+
+func TestRetryOnConnectionFailure(t *testing.T) {
+	server, tearDown := setupScriptedServer(t, "", okResponse)
+	defer tearDown(t)
+	client := retryingClient()
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_OK || len(server.requests()) != 2 {
+		t.Fatalf("Got status %d after %d attempts\n", response.StatusCode, len(server.requests()))
+	}
+}
+
+func TestStaleConnectionIsRetried(t *testing.T) {
+	server, tearDown := setupScriptedServer(t, okResponse, "", okResponse)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	for i := 0; i < 2; i++ {
+		request, err := NewRequest("http://localhost:1234/path")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		request.SetBody([]byte("payload"))
+		response, err := client.POST(request)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if response.StatusCode != STATUS_OK {
+			t.Fatalf("Wrong status %d\n", response.StatusCode)
+		}
+	}
+	if len(server.requests()) != 3 {
+		t.Fatalf("Got %d attempts\n", len(server.requests()))
+	}
+}
+
+func TestFirstConnectionFailureIsNotRetriedWithoutPolicy(t *testing.T) {
+	_, tearDown := setupScriptedServer(t, "", okResponse)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err = client.GET(request); err == nil {
+		t.Fatalf("Request on a new connection was retried")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := NewRetryPolicy()
+	policy.BaseDelay = 100 * time.Millisecond
+	policy.MaxDelay = 300 * time.Millisecond
+	for attempt := 1; attempt <= 10; attempt++ {
+		var ceiling = min(policy.BaseDelay<<(attempt-1), policy.MaxDelay)
+		for i := 0; i < 20; i++ {
+			if delay := policy.backoff(attempt); delay < 0 || delay > ceiling {
+				t.Errorf("Test failed. Attempt: %d; Delay %v is over %v\n", attempt, delay, ceiling)
+			}
+		}
+	}
+}
+
+type RetryAfterTest struct {
+	value         string
+	expected      time.Duration
+	expectedFound bool
+}
+
+var retryAfterTests = []RetryAfterTest{
+	{value: "120", expected: 120 * time.Second, expectedFound: true},
+	{value: "0", expected: 0, expectedFound: true},
+	{value: "Wed, 21 Oct 2015 07:28:00 GMT", expected: 0, expectedFound: true},
+	{value: "soon"},
+	{value: "-5"},
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, test := range retryAfterTests {
+		response := &ClientHTTPResponse{headers: make(Headers)}
+		for _, value := range strings.Split(test.value, ",") {
+			response.AddHeader("Retry-After", strings.TrimSpace(value))
+		}
+		delay, found := parseRetryAfter(response)
+		if found != test.expectedFound || delay != test.expected {
+			t.Errorf("Test failed. Value: %s; Expected: %v %v; Got: %v %v\n", test.value, test.expected, test.expectedFound, delay, found)
+		}
+	}
+}
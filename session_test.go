@@ -0,0 +1,279 @@
+package easyhttp
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testSessionOptions = func() SessionOptions {
+	options := DefaultSessionOptions()
+	options.Secure = false
+	return options
+}()
+
+func handleSessionLogin(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	session := request.Session()
+	if err := session.Regenerate(); err != nil {
+		response.SetStatus(STATUS_INTERNAL_ERROR)
+		return
+	}
+	session.Set("user", request.uri.Query().Get("user"))
+	response.SetStatus(STATUS_OK)
+}
+
+func handleSessionUser(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	user, found := request.Session().Get("user")
+	if !found {
+		response.SetStatus(STATUS_UNAUTHORIZED)
+		response.SetHeader("WWW-Authenticate", "Session")
+		return
+	}
+	response.SetStatus(STATUS_OK)
+	response.Write([]byte(user.(string)))
+}
+
+func handleSessionLogout(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	request.Session().Destroy()
+	response.SetStatus(STATUS_OK)
+}
+
+func TestSessionLogin(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/session/user")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_UNAUTHORIZED || len(response.Cookies()) != 0 {
+		t.Fatalf("Empty session issued a cookie")
+	}
+	// A session id planted before login must not survive it
+	planted := mustParseURL(t, "http://localhost:1234/")
+	plantedID := newSessionID()
+	client.SetCookies(planted, []*Cookie{{Name: DEFAULT_SESSION_COOKIE, Value: plantedID, Path: "/"}})
+
+	login, err := NewRequest("http://localhost:1234/session/login?user=alice")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err = client.GET(login)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cookies := response.Cookies()
+	if len(cookies) != 1 || !cookies[0].HTTPOnly || cookies[0].SameSite != SAME_SITE_LAX || cookies[0].Value == plantedID {
+		t.Fatalf("Got session cookies %v\n", response.GetHeader("Set-Cookie"))
+	}
+
+	response, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if body, _ := io.ReadAll(response.Body()); response.StatusCode != STATUS_OK || string(body) != "alice" {
+		t.Fatalf("Got status %d and body %s\n", response.StatusCode, body)
+	}
+
+	logout, err := NewRequest("http://localhost:1234/session/logout")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := client.GET(logout); err != nil {
+		t.Fatal(err.Error())
+	}
+	if cookies := client.Cookies(planted); len(cookies) != 0 {
+		t.Fatalf("Session cookie was not removed on logout")
+	}
+}
+
+// Runs the handler behind the middleware with the session cookie and returns the session cookie set, if any
+func runSession(middleware Middleware, cookieValue string, handler ResponseFunction) *Cookie {
+	request := ServerHTTPRequest{cookies: map[string]string{}}
+	if cookieValue != "" {
+		request.cookies[DEFAULT_SESSION_COOKIE] = cookieValue
+	}
+	response := &ServerHTTPResponse{}
+	middleware(handler)(request, response)
+	for _, cookie := range response.cookies {
+		if cookie.Name == DEFAULT_SESSION_COOKIE {
+			return cookie
+		}
+	}
+	return nil
+}
+
+type SessionStoreTest struct {
+	name       string
+	store      func(t *testing.T) SessionStore
+	serverSide bool
+}
+
+var sessionStoreTests = []SessionStoreTest{
+	{"Memory", func(t *testing.T) SessionStore { return NewMemorySessionStore() }, true},
+	{"File", func(t *testing.T) SessionStore {
+		store, err := NewFileSessionStore(filepath.Join(t.TempDir(), "sessions"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return store
+	}, true},
+	{"Cookie", func(t *testing.T) SessionStore {
+		store, err := NewCookieSessionStore([][]byte{bytes.Repeat([]byte("s"), 32)})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return store
+	}, false},
+}
+
+func TestSessionStores(t *testing.T) {
+	for _, test := range sessionStoreTests {
+		options := testSessionOptions
+		options.Store = test.store(t)
+		middleware := Sessions(options)
+
+		cookie := runSession(middleware, "", func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+			request.Session().Set("visits", 1)
+		})
+		if cookie == nil {
+			t.Errorf("Test failed. %s: no session cookie\n", test.name)
+			continue
+		}
+
+		var visits any
+		var id string
+		next := runSession(middleware, cookie.Value, func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+			visits, _ = request.Session().Get("visits")
+			id = request.Session().ID()
+			request.Session().Set("visits", visits.(int)+1)
+		})
+		if visits != 1 {
+			t.Errorf("Test failed. %s: session was not loaded, got %v\n", test.name, visits)
+			continue
+		}
+		if next != nil {
+			cookie = next
+		}
+
+		var regenerated string
+		next = runSession(middleware, cookie.Value, func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+			visits, _ = request.Session().Get("visits")
+			request.Session().Regenerate()
+			regenerated = request.Session().ID()
+		})
+		if visits != 2 || next == nil || regenerated == id {
+			t.Errorf("Test failed. %s: session was not regenerated\n", test.name)
+			continue
+		}
+		if test.serverSide {
+			if _, err := options.Store.Load(cookie.Value); err != ErrSessionNotFound {
+				t.Errorf("Test failed. %s: old session id still loads\n", test.name)
+			}
+		}
+
+		destroyed := runSession(middleware, next.Value, func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+			request.Session().Destroy()
+		})
+		if destroyed == nil || destroyed.MaxAge >= 0 {
+			t.Errorf("Test failed. %s: cookie was not expired on destroy\n", test.name)
+		}
+	}
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	for _, test := range sessionStoreTests {
+		options := testSessionOptions
+		options.Store = test.store(t)
+		options.IdleTimeout = 100 * time.Millisecond
+		options.AbsoluteTimeout = 250 * time.Millisecond
+		middleware := Sessions(options)
+
+		cookie := runSession(middleware, "", func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+			request.Session().Set("user", "alice")
+		})
+		var found bool
+		var readUser = func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+			_, found = request.Session().Get("user")
+		}
+		// Requests within the idle timeout keep the session until the absolute timeout
+		for range 3 {
+			time.Sleep(60 * time.Millisecond)
+			if next := runSession(middleware, cookie.Value, readUser); next != nil {
+				cookie = next
+			}
+			if !found {
+				t.Errorf("Test failed. %s: session expired before the idle timeout\n", test.name)
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+		runSession(middleware, cookie.Value, readUser)
+		if found {
+			t.Errorf("Test failed. %s: session outlived the absolute timeout\n", test.name)
+		}
+
+		cookie = runSession(middleware, "", func(request ServerHTTPRequest, response *ServerHTTPResponse) {
+			request.Session().Set("user", "bob")
+		})
+		time.Sleep(150 * time.Millisecond)
+		runSession(middleware, cookie.Value, readUser)
+		if found {
+			t.Errorf("Test failed. %s: session outlived the idle timeout\n", test.name)
+		}
+	}
+}
+
+func TestFileSessionStoreKeys(t *testing.T) {
+	directory := t.TempDir()
+	store, err := NewFileSessionStore(filepath.Join(directory, "sessions"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := os.WriteFile(filepath.Join(directory, "secret.session"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, key := range []string{"../secret", "", "short"} {
+		if _, err := store.Load(key); err != ErrSessionNotFound {
+			t.Errorf("Test failed. Key %q: expected ErrSessionNotFound, got %v\n", key, err)
+		}
+	}
+
+	record := SessionRecord{ID: newSessionID(), Values: map[string]any{"user": "alice"}}
+	if _, err := store.Save(record.ID, record, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := store.RemoveExpired(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if entries, _ := os.ReadDir(filepath.Join(directory, "sessions")); len(entries) != 0 {
+		t.Fatalf("Expired session files were not removed")
+	}
+}
+
+func TestCookieSessionStoreTampering(t *testing.T) {
+	store, err := NewCookieSessionStore([][]byte{bytes.Repeat([]byte("s"), 32)})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	value, err := store.Save("", SessionRecord{ID: newSessionID(), Values: map[string]any{"admin": false}}, time.Time{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := store.Load("B" + value[1:]); err != ErrSessionNotFound {
+		t.Fatalf("Tampered session was loaded")
+	}
+	if _, err := store.Save("", SessionRecord{ID: newSessionID(), Values: map[string]any{"blob": string(make([]byte, 5000))}}, time.Time{}); err == nil {
+		t.Fatalf("Session larger than a cookie was saved")
+	}
+	if _, err := NewCookieSessionStore([][]byte{[]byte("short")}); err == nil {
+		t.Fatalf("Short key was accepted")
+	}
+}
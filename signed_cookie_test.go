@@ -0,0 +1,152 @@
+package easyhttp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+var signingKey = bytes.Repeat([]byte("k"), 32)
+var oldSigningKey = bytes.Repeat([]byte("o"), 32)
+var encryptionKey = bytes.Repeat([]byte("e"), 32)
+var oldEncryptionKey = bytes.Repeat([]byte("p"), 16)
+
+func handleSetSecretCookies(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	response.SetStatus(STATUS_OK)
+	response.SetSignedCookie(&Cookie{Name: "cart", Value: "items=3", Path: "/"}, [][]byte{signingKey})
+	response.SetEncryptedCookie(&Cookie{Name: "session", Value: "user=42", Path: "/", MaxAge: 60}, [][]byte{encryptionKey})
+}
+
+func handleReadSecretCookies(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	cart, cartErr := request.SignedCookie("cart", [][]byte{signingKey})
+	session, sessionErr := request.EncryptedCookie("session", [][]byte{encryptionKey})
+	if cartErr != nil || sessionErr != nil {
+		response.SetStatus(STATUS_BAD_REQUEST)
+		return
+	}
+	response.SetStatus(STATUS_OK)
+	response.Write([]byte(cart + " " + session))
+}
+
+func TestSecretCookies(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/cookie/secret")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, cookie := range response.Cookies() {
+		if strings.Contains(cookie.Value, "user=42") {
+			t.Fatalf("Encrypted cookie is readable: %s\n", cookie.Value)
+		}
+	}
+
+	request, err = NewRequest("http://localhost:1234/cookie/secret/read")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if body, _ := io.ReadAll(response.Body()); response.StatusCode != STATUS_OK || string(body) != "items=3 user=42" {
+		t.Fatalf("Got status %d and body %s\n", response.StatusCode, body)
+	}
+}
+
+type SecretCookieTest struct {
+	name     string
+	cookie   Cookie
+	setKeys  [][]byte
+	readKeys [][]byte
+	tamper   func(value string) string
+	expected error
+}
+
+var secretCookieTests = []SecretCookieTest{
+	{"Valid", Cookie{Name: "id", Value: "42"}, [][]byte{signingKey}, [][]byte{signingKey}, nil, nil},
+	{"Rotated key", Cookie{Name: "id", Value: "42"}, [][]byte{oldSigningKey}, [][]byte{signingKey, oldSigningKey}, nil, nil},
+	{"Unknown key", Cookie{Name: "id", Value: "42"}, [][]byte{oldSigningKey}, [][]byte{signingKey}, nil, ErrCookieTampered},
+	{"Expired", Cookie{Name: "id", Value: "42", Expires: time.Now().Add(-time.Minute)}, [][]byte{signingKey}, [][]byte{signingKey}, nil, ErrCookieExpired},
+	{"Not expired", Cookie{Name: "id", Value: "42", MaxAge: 60}, [][]byte{signingKey}, [][]byte{signingKey}, nil, nil},
+	{"Changed value", Cookie{Name: "id", Value: "42"}, [][]byte{signingKey}, [][]byte{signingKey}, func(value string) string { return "B" + value[1:] }, ErrCookieTampered},
+	{"Garbage", Cookie{Name: "id", Value: "42"}, [][]byte{signingKey}, [][]byte{signingKey}, func(value string) string { return "garbage" }, ErrCookieTampered},
+}
+
+func TestSignedCookies(t *testing.T) {
+	for _, test := range secretCookieTests {
+		response := &ServerHTTPResponse{}
+		if err := response.SetSignedCookie(&test.cookie, test.setKeys); err != nil {
+			t.Fatal(err.Error())
+		}
+		value := response.cookies[0].Value
+		if test.tamper != nil {
+			value = test.tamper(value)
+		}
+		request := ServerHTTPRequest{cookies: map[string]string{test.cookie.Name: value}}
+		read, err := request.SignedCookie(test.cookie.Name, test.readKeys)
+		if !errors.Is(err, test.expected) || err == nil && read != test.cookie.Value {
+			t.Errorf("Test failed. %s: expected %v, got %q and %v\n", test.name, test.expected, read, err)
+		}
+	}
+}
+
+func TestEncryptedCookies(t *testing.T) {
+	for _, test := range secretCookieTests {
+		var setKeys, readKeys = [][]byte{encryptionKey}, [][]byte{encryptionKey}
+		if test.setKeys[0][0] == oldSigningKey[0] {
+			setKeys = [][]byte{oldEncryptionKey}
+			if len(test.readKeys) > 1 {
+				readKeys = [][]byte{encryptionKey, oldEncryptionKey}
+			}
+		}
+		response := &ServerHTTPResponse{}
+		if err := response.SetEncryptedCookie(&test.cookie, setKeys); err != nil {
+			t.Fatal(err.Error())
+		}
+		value := response.cookies[0].Value
+		if test.tamper != nil {
+			value = test.tamper(value)
+		}
+		request := ServerHTTPRequest{cookies: map[string]string{test.cookie.Name: value}}
+		read, err := request.EncryptedCookie(test.cookie.Name, readKeys)
+		if !errors.Is(err, test.expected) || err == nil && read != test.cookie.Value {
+			t.Errorf("Test failed. %s: expected %v, got %q and %v\n", test.name, test.expected, read, err)
+		}
+	}
+}
+
+func TestSecretCookieErrors(t *testing.T) {
+	response := &ServerHTTPResponse{}
+	if err := response.SetSignedCookie(&Cookie{Name: "id", Value: "1"}, [][]byte{[]byte("short")}); err == nil {
+		t.Fatalf("Short signing key was accepted")
+	}
+	if err := response.SetEncryptedCookie(&Cookie{Name: "id", Value: "1"}, [][]byte{[]byte("short")}); err == nil {
+		t.Fatalf("Bad encryption key was accepted")
+	}
+
+	var cookie = Cookie{Name: "id", Value: "1"}
+	if err := response.SetSignedCookie(&cookie, [][]byte{signingKey}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if cookie.Value != "1" {
+		t.Fatalf("Cookie of the caller was changed")
+	}
+	// A value signed for one cookie is not valid for another
+	request := ServerHTTPRequest{cookies: map[string]string{"admin": response.cookies[0].Value}}
+	if _, err := request.SignedCookie("admin", [][]byte{signingKey}); !errors.Is(err, ErrCookieTampered) {
+		t.Fatalf("Signed value was accepted for another cookie")
+	}
+	if _, err := request.EncryptedCookie("missing", [][]byte{encryptionKey}); !errors.Is(err, ErrCookieNotFound) {
+		t.Fatalf("Expected ErrCookieNotFound, got %v\n", err)
+	}
+}
@@ -0,0 +1,184 @@
+package easyhttp
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+var streamedEvents = []ServerSentEvent{
+	{ID: "1", Data: "first event", Retry: 3 * time.Second},
+	{ID: "2", Event: "update", Data: "second\nevent"},
+	{ID: "3", Data: "third event"},
+}
+
+var disconnectedStream = make(chan error, 1)
+
+func handleEvents(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	var start = 0
+	if lastEventID, err := strconv.Atoi(request.LastEventID()); err == nil {
+		start = lastEventID
+	}
+	if err := response.StartEventStream(20 * time.Millisecond); err != nil {
+		return
+	}
+	for _, event := range streamedEvents[start:] {
+		time.Sleep(30 * time.Millisecond)
+		if response.SendEvent(event) != nil {
+			return
+		}
+	}
+}
+
+func handleEndlessEvents(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	if err := response.StartEventStream(0); err != nil {
+		return
+	}
+	for id := 1; ; id++ {
+		if err := response.SendEvent(ServerSentEvent{ID: strconv.Itoa(id), Data: "tick"}); err != nil {
+			disconnectedStream <- request.Context().Err()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerSentEvents(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/events")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var events []ServerSentEvent
+	request.OnEventFunction(func(event ServerSentEvent, response *ClientHTTPResponse) bool {
+		events = append(events, event)
+		return true
+	})
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !response.HasHeaderValue("Content-Type", "text/event-stream") || !response.HasHeaderValue("Cache-Control", "no-cache") {
+		t.Fatalf("Wrong event stream headers %v", response.Headers())
+	}
+	if len(events) != len(streamedEvents) {
+		t.Fatalf("Expected %d events. Got %v", len(streamedEvents), events)
+	}
+	for i, event := range events {
+		var expectedType = streamedEvents[i].Event
+		if expectedType == "" {
+			expectedType = "message"
+		}
+		if event.ID != streamedEvents[i].ID || event.Event != expectedType || event.Data != streamedEvents[i].Data {
+			t.Fatalf("Expected event %v. Got %v", streamedEvents[i], event)
+		}
+		if event.Retry != 3*time.Second {
+			t.Fatalf("Retry was not kept. Got %v", event.Retry)
+		}
+	}
+}
+
+func TestServerSentEventsLastEventID(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/events")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetLastEventID("2")
+	var events []ServerSentEvent
+	request.OnEventFunction(func(event ServerSentEvent, response *ClientHTTPResponse) bool {
+		events = append(events, event)
+		return true
+	})
+	_, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(events) != 1 || events[0].ID != "3" {
+		t.Fatalf("Stream was not resumed. Got %v", events)
+	}
+}
+
+func TestServerSentEventsDisconnect(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/events/endless")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var received = 0
+	request.OnEventFunction(func(event ServerSentEvent, response *ClientHTTPResponse) bool {
+		received++
+		return received < 2
+	})
+	_, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	select {
+	case err := <-disconnectedStream:
+		if err == nil {
+			t.Fatalf("Request context was not cancelled")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Server did not detect the client disconnect")
+	}
+}
+
+type EventStreamTest struct {
+	chunks         []string
+	expectedEvents []ServerSentEvent
+}
+
+var eventStreamTests = []EventStreamTest{
+	{chunks: []string{"data: hello\n\n"}, expectedEvents: []ServerSentEvent{{Event: "message", Data: "hello"}}},
+	{chunks: []string{"\xEF\xBB", "\xBFdata:no space\r", "\n\r\n"}, expectedEvents: []ServerSentEvent{{Event: "message", Data: "no space"}}},
+	{chunks: []string{": heartbeat\n\n", "event: ping\nid: 7\ndata: a\ndata: b\r\r"}, expectedEvents: []ServerSentEvent{{Event: "ping", ID: "7", Data: "a\nb"}}},
+	{chunks: []string{"id: 1\n\n", "data: x\n", "\n"}, expectedEvents: []ServerSentEvent{{Event: "message", ID: "1", Data: "x"}}},
+	{chunks: []string{"retry: 500\ndata\n\n", "retry: bad\ndata: y\n\n"}, expectedEvents: []ServerSentEvent{{Event: "message", Retry: 500 * time.Millisecond}, {Event: "message", Data: "y", Retry: 500 * time.Millisecond}}},
+	{chunks: []string{"event: skipped\n\n", "data: incomplete"}},
+}
+
+func TestEventStreamParsing(t *testing.T) {
+	for _, test := range eventStreamTests {
+		var events []ServerSentEvent
+		parser := &eventStreamParser{onEvent: func(event ServerSentEvent, response *ClientHTTPResponse) bool {
+			events = append(events, event)
+			return true
+		}}
+		for _, chunk := range test.chunks {
+			parser.onChunk([]byte(chunk), nil)
+		}
+		if len(events) != len(test.expectedEvents) {
+			t.Errorf("Test failed. Chunks: %q; Expected: %v; Got: %v\n", test.chunks, test.expectedEvents, events)
+			continue
+		}
+		for i, event := range events {
+			if event != test.expectedEvents[i] {
+				t.Errorf("Test failed. Chunks: %q; Expected: %v; Got: %v\n", test.chunks, test.expectedEvents[i], event)
+			}
+		}
+	}
+}
+
+func TestServerSentEventFormat(t *testing.T) {
+	eventBytes, err := ServerSentEvent{Event: "update", ID: "9", Data: "one\r\ntwo", Retry: time.Second}.toBytes()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(eventBytes) != "event: update\nid: 9\nretry: 1000\ndata: one\ndata: two\n\n" {
+		t.Fatalf("Wrong event format %q", eventBytes)
+	}
+	if _, err = (ServerSentEvent{Event: "bad\ntype"}).toBytes(); err == nil {
+		t.Fatalf("Event type with line break was accepted")
+	}
+}
@@ -0,0 +1,212 @@
+package easyhttp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Reader that hides the length of its data, so the client cannot know it in advance
+type unknownLengthReader struct {
+	reader io.Reader
+}
+
+func (r unknownLengthReader) Read(buffer []byte) (int, error) {
+	return r.reader.Read(buffer)
+}
+
+func TestStreamedChunkedResponse(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/trailers")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.StreamResponse()
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if idleConnections(&client, "http://localhost:1234") != 0 {
+		t.Fatalf("Connection was released before the body was read")
+	}
+	body := response.Body()
+	defer body.Close()
+	bodyBytes, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(bodyBytes) != strings.Join(trailerChunks, "") {
+		t.Fatalf("Wrong body %s", bodyBytes)
+	}
+	if trailers := response.Trailers(); trailers["x-checksum"] == nil || trailers["x-checksum"][0] != trailerChecksum() {
+		t.Fatalf("Wrong trailers %v", trailers)
+	}
+	if !waitForIdleConnections(&client, "http://localhost:1234", 1) {
+		t.Fatalf("Connection was not released once the body was read")
+	}
+}
+
+func TestStreamedResponseWithContentLength(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.StreamResponse()
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	bodyBytes, err := io.ReadAll(response.Body())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(bodyBytes) != "Hello World!\n" {
+		t.Fatalf("Wrong body %s", bodyBytes)
+	}
+	if !waitForIdleConnections(&client, "http://localhost:1234", 1) {
+		t.Fatalf("Connection was not released once the body was read")
+	}
+}
+
+func TestStreamedResponseClosedEarly(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/trailers")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.StreamResponse()
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	body := response.Body()
+	buffer := make([]byte, 4)
+	if _, err = body.Read(buffer); err != nil {
+		t.Fatal(err.Error())
+	}
+	body.Close()
+	if _, err = body.Read(buffer); err == nil {
+		t.Fatalf("Read on a closed body did not fail")
+	}
+	if idleConnections(&client, "http://localhost:1234") != 0 {
+		t.Fatalf("Connection with unread data was kept in the pool")
+	}
+
+	request, err = NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_OK || !response.HasHeaderValue("TestHeader", "Hello") {
+		t.Fatalf("Wrong response after closing a body early")
+	}
+}
+
+func TestResponseShorterThanContentLength(t *testing.T) {
+	tearDown := setupClosingServer(t, "HTTP/1.1 200 OK\r\nContent-Length: 2000000000\r\n\r\nshort body")
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = client.GET(request)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("Got wrong error %v\n", err)
+	}
+}
+
+func TestRequestBodyReader(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	var bodyText = strings.Repeat("streamed request body\n", 200)
+	for _, length := range []int64{int64(len(bodyText)), -1} {
+		request, err := NewRequest("http://localhost:1234/large")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		request.SetBodyReader(unknownLengthReader{strings.NewReader(bodyText)}, length)
+		response, err := client.POST(request)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !bytes.Equal(response.body.Bytes(), []byte(bodyText)) {
+			t.Errorf("Test failed. Length: %d; Got body of %d bytes\n", length, response.body.Len())
+		}
+	}
+}
+
+func TestRequestBodyReaderTooShort(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/large")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetBodyReader(strings.NewReader("short"), 100)
+	if _, err = client.POST(request); err == nil {
+		t.Fatalf("Request with a body shorter than its length did not fail")
+	}
+}
+
+func TestRequestBodyReaderReplacesLength(t *testing.T) {
+	listener, err := net.Listen("tcp", ":1234")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer listener.Close()
+	var wireBytes = make(chan string, 1)
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer connection.Close()
+		var raw bytes.Buffer
+		request, err := http.ReadRequest(bufio.NewReader(io.TeeReader(connection, &raw)))
+		if err == nil {
+			io.ReadAll(request.Body)
+		}
+		wireBytes <- raw.String()
+		connection.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+	}()
+
+	client := NewHTTPClient()
+	request, err := NewRequestWithBody("http://localhost:1234/path", []byte("fixed body"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.SetBodyReader(unknownLengthReader{strings.NewReader("streamed body")}, -1)
+	if _, err = client.POST(request); err != nil {
+		t.Fatal(err.Error())
+	}
+	head, body, _ := strings.Cut(strings.ToLower(<-wireBytes), "\r\n\r\n")
+	if strings.Contains(head, "content-length") || !strings.Contains(head, "transfer-encoding: chunked") {
+		t.Fatalf("Wrong length headers sent:\n%s", head)
+	}
+	if !strings.Contains(body, "streamed body") || strings.Contains(body, "fixed body") {
+		t.Fatalf("Wrong body sent:\n%s", body)
+	}
+}
@@ -0,0 +1,182 @@
+package easyhttp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+var trailerChunks = []string{"first chunk\n", "second chunk\n", "third chunk\n"}
+
+func trailerChecksum() string {
+	checksum := sha256.Sum256([]byte(strings.Join(trailerChunks, "")))
+	return hex.EncodeToString(checksum[:])
+}
+
+func handleTrailers(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	response.SetStatus(STATUS_OK)
+	response.DeclareTrailer("X-Checksum")
+	hash := sha256.New()
+	for _, chunk := range trailerChunks {
+		hash.Write([]byte(chunk))
+		response.Write([]byte(chunk))
+		response.SendChunk()
+	}
+	response.SetTrailer("X-Checksum", hex.EncodeToString(hash.Sum(nil)))
+	response.SetTrailer("Content-Length", "10")
+}
+
+func handleTrailerEcho(request ServerHTTPRequest, response *ServerHTTPResponse) {
+	response.SetStatus(STATUS_OK)
+	if checksum := request.Trailers()["x-checksum"]; checksum != nil {
+		response.SetHeader("Received-Checksum", checksum[0])
+	}
+	response.Write(request.Body)
+}
+
+func handleExtensionChunk(chunk []byte, request ServerHTTPRequest, response *ServerHTTPResponse) bool {
+	if signature, ok := request.ChunkExtensions()["signature"]; ok {
+		response.AddHeader("Chunk-Signature", signature)
+	}
+	return true
+}
+
+type ChunkSizeLineTest struct {
+	line               string
+	expectedLength     uint64
+	expectedExtensions map[string]string
+	expectedError      bool
+}
+
+var chunkSizeLineTests = []ChunkSizeLineTest{
+	{line: "1a", expectedLength: 26},
+	{line: "1A ", expectedLength: 26},
+	{line: "1a;name=val", expectedLength: 26, expectedExtensions: map[string]string{"name": "val"}},
+	{line: "ff ; Name = \"quoted; value\" ; flag", expectedLength: 255, expectedExtensions: map[string]string{"name": "quoted; value", "flag": ""}},
+	{line: "0;last", expectedLength: 0, expectedExtensions: map[string]string{"last": ""}},
+	{line: "zz", expectedError: true},
+	{line: "10;=value", expectedError: true},
+}
+
+func TestChunkSizeLineParsing(t *testing.T) {
+	for _, test := range chunkSizeLineTests {
+		length, extensions, err := parseChunkSizeLine(test.line)
+		if (err != nil) != test.expectedError {
+			t.Errorf("Test failed. Line: %s; Expected error: %v; Got: %v\n", test.line, test.expectedError, err)
+			continue
+		}
+		if length != test.expectedLength || len(extensions) != len(test.expectedExtensions) {
+			t.Errorf("Test failed. Line: %s; Got length %d and extensions %v\n", test.line, length, extensions)
+			continue
+		}
+		for name, value := range test.expectedExtensions {
+			if extensions[name] != value {
+				t.Errorf("Test failed. Line: %s; Expected extensions: %v; Got: %v\n", test.line, test.expectedExtensions, extensions)
+			}
+		}
+	}
+}
+
+func TestResponseTrailers(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/trailers")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response, err := client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !response.HasHeaderValue("Trailer", "X-Checksum") {
+		t.Fatalf("Trailer was not declared")
+	}
+	body, _ := io.ReadAll(response.GetBody())
+	if string(body) != strings.Join(trailerChunks, "") {
+		t.Fatalf("Wrong body %s", body)
+	}
+	trailers := response.Trailers()
+	if trailers["x-checksum"] == nil || trailers["x-checksum"][0] != trailerChecksum() {
+		t.Fatalf("Wrong trailers %v", trailers)
+	}
+	if _, exists := trailers["content-length"]; exists {
+		t.Fatalf("Forbidden trailer was sent")
+	}
+
+	request, err = NewRequest("http://localhost:1234/path")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.CloseConnection()
+	response, err = client.GET(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_OK || !response.HasHeaderValue("TestHeader", "Hello") {
+		t.Fatalf("Connection was left in a bad state after trailers")
+	}
+}
+
+func TestRequestTrailers(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+	client := NewHTTPClient()
+
+	request, err := NewRequest("http://localhost:1234/trailers")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.CloseConnection()
+	request.Chunked()
+	request.DeclareTrailer("X-Checksum")
+
+	go func() {
+		for _, chunk := range trailerChunks {
+			request.SendChunk([]byte(chunk))
+		}
+		request.SetTrailer("X-Checksum", trailerChecksum())
+		request.Done()
+	}()
+
+	response, err := client.POST(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !response.HasHeaderValue("Received-Checksum", trailerChecksum()) {
+		t.Fatalf("Server did not receive the trailers")
+	}
+	body, _ := io.ReadAll(response.GetBody())
+	if string(body) != strings.Join(trailerChunks, "") {
+		t.Fatalf("Wrong body %s", body)
+	}
+}
+
+func TestRequestChunkExtensions(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	connection, err := net.Dial("tcp", "localhost:1234")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer connection.Close()
+	connection.Write([]byte("POST /extensions HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n" +
+		"5;signature=abc\r\nhello\r\n6 ; signature=\"d;ef\"\r\n world\r\n0\r\nX-Checksum: 1234\r\n\r\n"))
+
+	responseBytes, err := io.ReadAll(connection)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	response := string(responseBytes)
+	if !strings.HasPrefix(response, "HTTP/1.1 200 OK") {
+		t.Fatalf("Wrong response %s", response)
+	}
+	if !strings.Contains(response, "chunk-signature: abc, d;ef") || !strings.Contains(response, "received-checksum: 1234") {
+		t.Fatalf("Chunk extensions or trailers missing %s", response)
+	}
+}
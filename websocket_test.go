@@ -0,0 +1,171 @@
+package easyhttp
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func handleWebSocketEcho(request ServerHTTPRequest, webSocket *WebSocketConn) {
+	for {
+		messageType, message, err := webSocket.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err = webSocket.WriteMessage(messageType, message); err != nil {
+			return
+		}
+	}
+}
+
+func dialTestWebSocket(t *testing.T, uri string) *WebSocketConn {
+	client := NewHTTPClient()
+	request, err := NewRequest(uri)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	request.AddHeader("Sec-WebSocket-Protocol", "unknown")
+	request.AddHeader("Sec-WebSocket-Protocol", "chat")
+	webSocket, response, err := client.DialWebSocket(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_SWITCHING_PROTOCOL {
+		t.Fatalf("Wrong handshake status %d", response.StatusCode)
+	}
+	if request.GetHeader("Upgrade") != nil || request.GetHeader("Sec-WebSocket-Key") != nil || request.GetHeader("Host") != nil {
+		t.Fatalf("Handshake headers were added to the caller's request")
+	}
+	return webSocket
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	webSocket := dialTestWebSocket(t, "ws://localhost:1234/websocket")
+	if webSocket.Subprotocol() != "chat" {
+		t.Fatalf("Wrong subprotocol %s", webSocket.Subprotocol())
+	}
+
+	if err := webSocket.WriteMessage(WEBSOCKET_TEXT_MESSAGE, []byte("Hello WebSocket")); err != nil {
+		t.Fatal(err.Error())
+	}
+	messageType, message, err := webSocket.ReadMessage()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if messageType != WEBSOCKET_TEXT_MESSAGE || string(message) != "Hello WebSocket" {
+		t.Fatalf("Wrong echo %d %s", messageType, message)
+	}
+
+	largeMessage := bytes.Repeat([]byte{0, 1, 2, 3}, 20000)
+	if err = webSocket.WriteFragmentedMessage(WEBSOCKET_BINARY_MESSAGE, largeMessage, 1000); err != nil {
+		t.Fatal(err.Error())
+	}
+	messageType, message, err = webSocket.ReadMessage()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if messageType != WEBSOCKET_BINARY_MESSAGE || !bytes.Equal(message, largeMessage) {
+		t.Fatalf("Wrong fragmented echo of %d bytes", len(message))
+	}
+
+	var pong = make(chan []byte, 1)
+	webSocket.SetPongHandler(func(data []byte) {
+		pong <- data
+	})
+	if err = webSocket.Ping([]byte("ping")); err != nil {
+		t.Fatal(err.Error())
+	}
+	webSocket.WriteMessage(WEBSOCKET_TEXT_MESSAGE, []byte("after ping"))
+	if _, message, err = webSocket.ReadMessage(); err != nil || string(message) != "after ping" {
+		t.Fatalf("Wrong message after ping %s %v", message, err)
+	}
+	select {
+	case data := <-pong:
+		if string(data) != "ping" {
+			t.Fatalf("Wrong pong payload %s", data)
+		}
+	default:
+		t.Fatalf("Pong was not received")
+	}
+
+	if err = webSocket.Close(WEBSOCKET_CLOSE_NORMAL, "bye"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = webSocket.WriteMessage(WEBSOCKET_TEXT_MESSAGE, []byte("closed")); err != ErrWebSocketClosed {
+		t.Fatalf("Write after close returned %v", err)
+	}
+}
+
+func TestWebSocketMessageTooBig(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	webSocket := dialTestWebSocket(t, "ws://localhost:1234/websocket/small")
+	webSocket.WriteMessage(WEBSOCKET_BINARY_MESSAGE, make([]byte, 64))
+	webSocket.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := webSocket.ReadMessage()
+	var closeError *WebSocketCloseError
+	if !errors.As(err, &closeError) || closeError.Code != WEBSOCKET_CLOSE_MESSAGE_TOO_BIG {
+		t.Fatalf("Expected close code %d. Got %v", WEBSOCKET_CLOSE_MESSAGE_TOO_BIG, err)
+	}
+}
+
+func TestWebSocketUnmaskedClientFrame(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	webSocket := dialTestWebSocket(t, "ws://localhost:1234/websocket")
+	webSocket.client = false
+	webSocket.WriteMessage(WEBSOCKET_TEXT_MESSAGE, []byte("unmasked"))
+	webSocket.client = true
+	webSocket.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := webSocket.ReadMessage()
+	var closeError *WebSocketCloseError
+	if !errors.As(err, &closeError) || closeError.Code != WEBSOCKET_CLOSE_PROTOCOL_ERROR {
+		t.Fatalf("Expected close code %d. Got %v", WEBSOCKET_CLOSE_PROTOCOL_ERROR, err)
+	}
+}
+
+func TestWebSocketHandshakeRejected(t *testing.T) {
+	tearDown := setupServer(t)
+	defer tearDown(t)
+
+	response, err := http.Get("http://localhost:1234/websocket")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_UPGRADE_REQUIRED {
+		t.Fatalf("Expected status %d. Got %d", STATUS_UPGRADE_REQUIRED, response.StatusCode)
+	}
+
+	request, _ := http.NewRequest("GET", "http://localhost:1234/websocket", nil)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "8")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if response.StatusCode != STATUS_UPGRADE_REQUIRED || response.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Fatalf("Wrong version negotiation %d %v", response.StatusCode, response.Header)
+	}
+
+	client := NewHTTPClient()
+	clientRequest, _ := NewRequest("ws://localhost:1234/path")
+	_, _, err = client.DialWebSocket(clientRequest)
+	if err != ErrWebSocketHandshake {
+		t.Fatalf("Expected handshake error. Got %v", err)
+	}
+}
+
+func TestWebSocketAccept(t *testing.T) {
+	if accept := webSocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Wrong accept value %s", accept)
+	}
+}